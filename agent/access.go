@@ -0,0 +1,52 @@
+package agent
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/aymenfurter/bicep-copilot/copilot"
+	"github.com/aymenfurter/bicep-copilot/identity"
+)
+
+const accessDeniedMessage = "Sorry, this Bicep Copilot deployment is only available to approved organizations, teams and users. Please contact the maintainers of this extension if you need access."
+
+func (s *Service) resolveUser(ctx context.Context, policy identity.Policy, apiToken string) (*identity.Identity, *copilot.Error) {
+	if s.identity == nil {
+		return nil, nil
+	}
+
+	user, err := s.identity.Resolve(ctx, apiToken)
+	if err != nil {
+		log.Printf("Failed to resolve GitHub identity: %v", err)
+		if policy.Enabled() {
+			return nil, &copilot.Error{
+				Type:       copilot.ErrorTypeAgent,
+				Code:       "identity_unavailable",
+				Message:    "Sorry, I couldn't verify your GitHub identity. Please try again in a moment.",
+				Identifier: "identity",
+			}
+		}
+		return nil, nil
+	}
+
+	if !policy.Allows(user) {
+		log.Printf("Denied access for GitHub user %s", user.Login)
+		return nil, &copilot.Error{
+			Type:       copilot.ErrorTypeAgent,
+			Code:       "access_denied",
+			Message:    accessDeniedMessage,
+			Identifier: "access",
+		}
+	}
+
+	return user, nil
+}
+
+func writeCopilotError(w http.ResponseWriter, copilotErr copilot.Error) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	if err := copilot.WriteErrors(w, copilotErr); err != nil {
+		log.Printf("Failed to write Copilot error: %v", err)
+	}
+}
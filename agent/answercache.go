@@ -0,0 +1,153 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aymenfurter/bicep-copilot/copilot"
+	"github.com/aymenfurter/bicep-copilot/retrieval"
+)
+
+const (
+	defaultAnswerCacheThreshold  = 0.95
+	defaultAnswerCacheMaxEntries = 500
+)
+
+type QueryEmbedder interface {
+	EmbedQuery(ctx context.Context, query string) ([]float32, error)
+	Version() string
+}
+
+type AnswerCacheOptions struct {
+	TTL        time.Duration
+	Threshold  float32
+	MaxEntries int
+}
+
+// AnswerKey identifies a cacheable answer. Rendered prompts include the
+// user's login, so answers are only replayed to the user they were built for.
+type AnswerKey struct {
+	embedding  []float32
+	model      copilot.Model
+	user       string
+	version    string
+	generation int
+}
+
+type cachedAnswer struct {
+	AnswerKey
+	events    []copilot.Event
+	createdAt time.Time
+}
+
+type AnswerCache struct {
+	mu         sync.Mutex
+	embedder   QueryEmbedder
+	ttl        time.Duration
+	threshold  float32
+	maxEntries int
+	version    string
+	generation int
+	entries    []*cachedAnswer
+	now        func() time.Time
+}
+
+func NewAnswerCache(embedder QueryEmbedder, opts AnswerCacheOptions) *AnswerCache {
+	if opts.Threshold <= 0 {
+		opts.Threshold = defaultAnswerCacheThreshold
+	}
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = defaultAnswerCacheMaxEntries
+	}
+
+	return &AnswerCache{
+		embedder:   embedder,
+		ttl:        opts.TTL,
+		threshold:  opts.Threshold,
+		maxEntries: opts.MaxEntries,
+		now:        time.Now,
+	}
+}
+
+func (c *AnswerCache) Lookup(ctx context.Context, query string, model copilot.Model, user string) ([]copilot.Event, AnswerKey, bool, error) {
+	embedding, err := c.embedder.EmbedQuery(ctx, query)
+	if err != nil {
+		return nil, AnswerKey{}, false, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.syncVersion()
+	c.evictExpired()
+
+	key := AnswerKey{embedding: embedding, model: model, user: user, version: c.version, generation: c.generation}
+	var best *cachedAnswer
+	var bestScore float32
+	for _, entry := range c.entries {
+		if entry.model != model || entry.user != user {
+			continue
+		}
+		score := retrieval.CosineSimilarity(embedding, entry.embedding)
+		if score >= c.threshold && score > bestScore {
+			best, bestScore = entry, score
+		}
+	}
+
+	if best == nil {
+		return nil, key, false, nil
+	}
+	return best.events, key, true, nil
+}
+
+// Store drops the answer when the corpus changed or the cache was invalidated
+// since the Lookup that produced key, since it was built from stale inputs.
+func (c *AnswerCache) Store(key AnswerKey, events []copilot.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.syncVersion()
+	if key.version != c.version || key.generation != c.generation {
+		return
+	}
+	c.entries = append(c.entries, &cachedAnswer{
+		AnswerKey: key,
+		events:    events,
+		createdAt: c.now(),
+	})
+
+	if len(c.entries) > c.maxEntries {
+		c.entries = c.entries[len(c.entries)-c.maxEntries:]
+	}
+}
+
+func (c *AnswerCache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = nil
+	c.generation++
+}
+
+func (c *AnswerCache) syncVersion() {
+	version := c.embedder.Version()
+	if version != c.version {
+		c.version = version
+		c.entries = nil
+	}
+}
+
+func (c *AnswerCache) evictExpired() {
+	if c.ttl <= 0 {
+		return
+	}
+
+	cutoff := c.now().Add(-c.ttl)
+	kept := c.entries[:0]
+	for _, entry := range c.entries {
+		if entry.createdAt.After(cutoff) {
+			kept = append(kept, entry)
+		}
+	}
+	c.entries = kept
+}
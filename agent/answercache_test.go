@@ -0,0 +1,111 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aymenfurter/bicep-copilot/copilot"
+)
+
+type fakeEmbedder struct {
+	embeddings map[string][]float32
+	version    string
+}
+
+func (f *fakeEmbedder) EmbedQuery(ctx context.Context, query string) ([]float32, error) {
+	return f.embeddings[query], nil
+}
+
+func (f *fakeEmbedder) Version() string {
+	return f.version
+}
+
+func TestAnswerCache(t *testing.T) {
+	embedder := &fakeEmbedder{
+		version: "v1",
+		embeddings: map[string][]float32{
+			"latest apiVersion for Key Vault":   {1, 0, 0},
+			"latest api version for key vault?": {0.99, 0.05, 0},
+			"how do I deploy a storage account": {0, 1, 0},
+		},
+	}
+
+	now := time.Now()
+	cache := NewAnswerCache(embedder, AnswerCacheOptions{TTL: time.Hour, Threshold: 0.95})
+	cache.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	_, key, hit, err := cache.Lookup(ctx, "latest apiVersion for Key Vault", copilot.ModelGPT4o, "octocat")
+	if err != nil || hit {
+		t.Fatalf("Lookup() on empty cache = %v, %v, want miss", hit, err)
+	}
+
+	answer := []copilot.Event{{Data: `{"choices":[{"delta":{"content":"2023-07-01"}}]}`}}
+	cache.Store(key, answer)
+
+	if events, _, hit, _ := cache.Lookup(ctx, "latest api version for key vault?", copilot.ModelGPT4o, "octocat"); !hit || len(events) != 1 {
+		t.Errorf("Lookup() similar question = %v, want hit", hit)
+	}
+
+	if _, _, hit, _ := cache.Lookup(ctx, "how do I deploy a storage account", copilot.ModelGPT4o, "octocat"); hit {
+		t.Error("Lookup() unrelated question = hit, want miss")
+	}
+
+	if _, _, hit, _ := cache.Lookup(ctx, "latest apiVersion for Key Vault", copilot.ModelGPT41, "octocat"); hit {
+		t.Error("Lookup() with different model = hit, want miss")
+	}
+
+	if _, _, hit, _ := cache.Lookup(ctx, "latest apiVersion for Key Vault", copilot.ModelGPT4o, "hubot"); hit {
+		t.Error("Lookup() for a different user = hit, want miss")
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, _, hit, _ := cache.Lookup(ctx, "latest apiVersion for Key Vault", copilot.ModelGPT4o, "octocat"); hit {
+		t.Error("Lookup() after TTL = hit, want miss")
+	}
+
+	cache.Store(key, answer)
+	embedder.version = "v2"
+	if _, _, hit, _ := cache.Lookup(ctx, "latest apiVersion for Key Vault", copilot.ModelGPT4o, "octocat"); hit {
+		t.Error("Lookup() after corpus refresh = hit, want miss")
+	}
+}
+
+func TestAnswerCacheDropsStaleStores(t *testing.T) {
+	embedder := &fakeEmbedder{
+		version:    "v1",
+		embeddings: map[string][]float32{"latest apiVersion for Key Vault": {1, 0, 0}},
+	}
+	cache := NewAnswerCache(embedder, AnswerCacheOptions{TTL: time.Hour})
+	answer := []copilot.Event{{Data: `{"choices":[{"delta":{"content":"2023-07-01"}}]}`}}
+
+	ctx := context.Background()
+	lookup := func() (AnswerKey, bool) {
+		_, key, hit, err := cache.Lookup(ctx, "latest apiVersion for Key Vault", copilot.ModelGPT4o, "octocat")
+		if err != nil {
+			t.Fatalf("Lookup() error = %v", err)
+		}
+		return key, hit
+	}
+
+	key, _ := lookup()
+	embedder.version = "v2"
+	cache.Store(key, answer)
+	if _, hit := lookup(); hit {
+		t.Error("Lookup() after storing an answer built from the old corpus = hit, want miss")
+	}
+
+	key, _ = lookup()
+	cache.Invalidate()
+	cache.Store(key, answer)
+	if _, hit := lookup(); hit {
+		t.Error("Lookup() after storing an answer started before Invalidate() = hit, want miss")
+	}
+
+	key, _ = lookup()
+	cache.Store(key, answer)
+	if _, hit := lookup(); !hit {
+		t.Error("Lookup() after Store() = miss, want hit")
+	}
+}
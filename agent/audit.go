@@ -0,0 +1,235 @@
+package agent
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aymenfurter/bicep-copilot/retrieval"
+)
+
+const (
+	defaultAuditMaxBytes  = 10 << 20
+	defaultAuditRetention = 30 * 24 * time.Hour
+
+	auditRotationLayout = "20060102T150405.000000000"
+	auditPruneInterval  = time.Hour
+)
+
+type AuditSource struct {
+	Path  string  `json:"path"`
+	Score float32 `json:"score"`
+}
+
+type AuditRecord struct {
+	Time            time.Time     `json:"time"`
+	User            string        `json:"user"`
+	IntegrationID   string        `json:"integration_id,omitempty"`
+	Question        string        `json:"question"`
+	Sources         []AuditSource `json:"sources"`
+	Model           string        `json:"model,omitempty"`
+	FinishReason    string        `json:"finish_reason,omitempty"`
+	Cached          bool          `json:"cached"`
+	Degraded        bool          `json:"degraded,omitempty"`
+	Redactions      int           `json:"redactions"`
+	FlaggedMessages int           `json:"flagged_messages"`
+	LatencyMS       int64         `json:"latency_ms"`
+	Answer          string        `json:"answer"`
+	Error           string        `json:"error,omitempty"`
+}
+
+type AuditOptions struct {
+	Path      string
+	MaxBytes  int64
+	Retention time.Duration
+	UserSalt  string
+}
+
+type AuditLog struct {
+	mu        sync.Mutex
+	path      string
+	maxBytes  int64
+	retention time.Duration
+	userSalt  []byte
+	file      *os.File
+	size      int64
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+func NewAuditLog(opts AuditOptions) (*AuditLog, error) {
+	if opts.Path == "" {
+		return nil, fmt.Errorf("audit log path is required")
+	}
+	if opts.UserSalt == "" {
+		return nil, fmt.Errorf("audit user salt is required")
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = defaultAuditMaxBytes
+	}
+	if opts.Retention <= 0 {
+		opts.Retention = defaultAuditRetention
+	}
+
+	if err := os.MkdirAll(filepath.Dir(opts.Path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+
+	a := &AuditLog{
+		path:      opts.Path,
+		maxBytes:  opts.MaxBytes,
+		retention: opts.Retention,
+		userSalt:  []byte(opts.UserSalt),
+		now:       time.Now,
+	}
+
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	a.prune()
+	return a, nil
+}
+
+func (a *AuditLog) Record(rec AuditRecord) {
+	if a == nil {
+		return
+	}
+	if rec.Time.IsZero() {
+		rec.Time = a.now().UTC()
+	}
+	rec.User = a.hashUser(rec.User)
+	rec.Question, _ = redactSecrets(rec.Question)
+	rec.Answer, _ = redactSecrets(rec.Answer)
+	rec.Error, _ = redactSecrets(rec.Error)
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		log.Printf("Failed to encode audit record: %v", err)
+		return
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.size > 0 && a.size+int64(len(line)) > a.maxBytes {
+		if err := a.rotate(); err != nil {
+			log.Printf("Failed to rotate audit log: %v", err)
+		}
+	}
+	if a.now().Sub(a.lastPrune) > auditPruneInterval {
+		a.prune()
+	}
+	if a.file == nil {
+		if err := a.open(); err != nil {
+			log.Printf("Failed to reopen audit log: %v", err)
+			return
+		}
+	}
+
+	n, err := a.file.Write(line)
+	a.size += int64(n)
+	if err != nil {
+		log.Printf("Failed to write audit record: %v", err)
+	}
+}
+
+func (a *AuditLog) Close() error {
+	if a == nil {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil {
+		return nil
+	}
+	return a.file.Close()
+}
+
+func (a *AuditLog) open() error {
+	file, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat audit log: %w", err)
+	}
+
+	a.file = file
+	a.size = info.Size()
+	return nil
+}
+
+func (a *AuditLog) rotate() error {
+	if a.file != nil {
+		if err := a.file.Close(); err != nil {
+			return err
+		}
+		a.file = nil
+	}
+
+	renameErr := os.Rename(a.path, a.rotatedPath(a.now()))
+	if err := a.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+	a.prune()
+	return nil
+}
+
+func (a *AuditLog) rotatedPath(t time.Time) string {
+	ext := filepath.Ext(a.path)
+	return strings.TrimSuffix(a.path, ext) + "-" + t.UTC().Format(auditRotationLayout) + ext
+}
+
+func (a *AuditLog) prune() {
+	a.lastPrune = a.now()
+
+	ext := filepath.Ext(a.path)
+	pattern := strings.TrimSuffix(a.path, ext) + "-*" + ext
+	rotated, err := filepath.Glob(pattern)
+	if err != nil {
+		return
+	}
+
+	cutoff := a.now().Add(-a.retention)
+	for _, path := range rotated {
+		info, err := os.Stat(path)
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			log.Printf("Failed to remove expired audit log %s: %v", path, err)
+		}
+	}
+}
+
+func (a *AuditLog) hashUser(user string) string {
+	if user == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, a.userSalt)
+	mac.Write([]byte(strings.ToLower(user)))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+func auditSources(docs []*retrieval.Document) []AuditSource {
+	sources := make([]AuditSource, 0, len(docs))
+	for _, doc := range docs {
+		sources = append(sources, AuditSource{Path: doc.Path, Score: doc.Score})
+	}
+	return sources
+}
@@ -0,0 +1,128 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readAuditRecords(t *testing.T, path string) []AuditRecord {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer file.Close()
+
+	var records []AuditRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var rec AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("Unmarshal() error = %v", err)
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+func TestAuditLogHashesAndRedacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.ndjson")
+	audit, err := NewAuditLog(AuditOptions{Path: path, UserSalt: "salt"})
+	if err != nil {
+		t.Fatalf("NewAuditLog() error = %v", err)
+	}
+
+	audit.Record(AuditRecord{
+		User:     "octocat",
+		Question: "AccountKey=c2VjcmV0a2V5c2VjcmV0a2V5c2VjcmV0a2V5== fails",
+		Sources:  []AuditSource{{Path: "storage/accounts.md", Score: 0.87}},
+		Answer:   "Use a Key Vault reference.",
+	})
+	audit.Close()
+
+	records := readAuditRecords(t, path)
+	if len(records) != 1 {
+		t.Fatalf("audit log has %d records, want 1", len(records))
+	}
+	rec := records[0]
+	if rec.User == "" || strings.Contains(rec.User, "octocat") {
+		t.Errorf("User = %q, want hashed identity", rec.User)
+	}
+	if strings.Contains(rec.Question, "c2VjcmV0a2V5") {
+		t.Errorf("Question = %q, want secret redacted", rec.Question)
+	}
+	if len(rec.Sources) != 1 || rec.Sources[0].Path != "storage/accounts.md" {
+		t.Errorf("Sources = %+v", rec.Sources)
+	}
+}
+
+func TestAuditLogRotationAndRetention(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.ndjson")
+
+	expired := filepath.Join(dir, "audit-20200101T000000.000000000.ndjson")
+	if err := os.WriteFile(expired, []byte("{}\n"), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	os.Chtimes(expired, old, old)
+
+	audit, err := NewAuditLog(AuditOptions{Path: path, MaxBytes: 200, Retention: 24 * time.Hour, UserSalt: "salt"})
+	if err != nil {
+		t.Fatalf("NewAuditLog() error = %v", err)
+	}
+	defer audit.Close()
+
+	if _, err := os.Stat(expired); !os.IsNotExist(err) {
+		t.Errorf("expired audit log still exists: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		audit.Record(AuditRecord{User: "octocat", Question: "question", Answer: strings.Repeat("a", 100)})
+	}
+
+	rotated, _ := filepath.Glob(filepath.Join(dir, "audit-*.ndjson"))
+	if len(rotated) != 2 {
+		t.Errorf("rotated files = %v, want 2", rotated)
+	}
+	if records := readAuditRecords(t, path); len(records) != 1 {
+		t.Errorf("current audit log has %d records, want 1", len(records))
+	}
+}
+
+func TestAuditLogKeepsWritingWhenRotationFails(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.ndjson")
+
+	audit, err := NewAuditLog(AuditOptions{Path: path, MaxBytes: 200, UserSalt: "salt"})
+	if err != nil {
+		t.Fatalf("NewAuditLog() error = %v", err)
+	}
+	defer audit.Close()
+
+	now := time.Now()
+	audit.now = func() time.Time { return now }
+	if err := os.MkdirAll(filepath.Join(audit.rotatedPath(now), "blocked"), 0700); err != nil {
+		t.Fatalf("MkdirAll() error = %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		audit.Record(AuditRecord{User: "octocat", Question: "question", Answer: strings.Repeat("a", 100)})
+	}
+
+	if records := readAuditRecords(t, path); len(records) != 3 {
+		t.Errorf("audit log has %d records after failed rotations, want 3", len(records))
+	}
+}
+
+func TestNewAuditLogRequiresSalt(t *testing.T) {
+	if _, err := NewAuditLog(AuditOptions{Path: filepath.Join(t.TempDir(), "audit.ndjson")}); err == nil {
+		t.Error("NewAuditLog() without a user salt error = nil, want error")
+	}
+}
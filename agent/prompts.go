@@ -0,0 +1,150 @@
+package agent
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/aymenfurter/bicep-copilot/retrieval"
+)
+
+const (
+	systemPromptName  = "system.tmpl"
+	contextPromptName = "context.tmpl"
+	editorPromptName  = "editor.tmpl"
+)
+
+//go:embed prompts/*.tmpl
+var defaultPrompts embed.FS
+
+type PromptData struct {
+	Corpus string
+	User   string
+	Docs   []*retrieval.Document
+	Files  []EditorFile
+}
+
+type Prompts struct {
+	system  *template.Template
+	context *template.Template
+	editor  *template.Template
+}
+
+func LoadPrompts(dir string) (*Prompts, error) {
+	defaults, err := fs.Sub(defaultPrompts, "prompts")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open default prompts: %w", err)
+	}
+
+	if dir != "" {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return nil, fmt.Errorf("prompt template directory: %w", err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("prompt template directory %s is not a directory", dir)
+		}
+	}
+
+	p := &Prompts{}
+	targets := map[string]**template.Template{
+		systemPromptName:  &p.system,
+		contextPromptName: &p.context,
+		editorPromptName:  &p.editor,
+	}
+
+	var overridden []string
+	for name, target := range targets {
+		text, custom, err := readPrompt(defaults, dir, name)
+		if err != nil {
+			return nil, err
+		}
+		if custom {
+			overridden = append(overridden, name)
+		}
+
+		tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse prompt template %s: %w", name, err)
+		}
+		*target = tmpl
+	}
+
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+
+	if dir != "" {
+		sort.Strings(overridden)
+		if len(overridden) == 0 {
+			overridden = []string{"none"}
+		}
+		log.Printf("Loaded prompt templates from %s, overriding: %s (others use the built-in defaults)", dir, strings.Join(overridden, ", "))
+	}
+	return p, nil
+}
+
+func readPrompt(defaults fs.FS, dir, name string) (string, bool, error) {
+	if dir != "" {
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if err == nil {
+			return string(content), true, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", false, fmt.Errorf("failed to read prompt template %s: %w", name, err)
+		}
+	}
+
+	content, err := fs.ReadFile(defaults, name)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read default prompt template %s: %w", name, err)
+	}
+	return string(content), false, nil
+}
+
+func (p *Prompts) validate() error {
+	sample := &PromptData{
+		Corpus: "owner/repo",
+		User:   "octocat",
+		Docs: []*retrieval.Document{
+			{Path: "sample.md", Content: "sample content", Modified: time.Now()},
+		},
+		Files: []EditorFile{
+			{Path: "main.bicep", Content: "param location string"},
+		},
+	}
+
+	for _, render := range []func(*PromptData) (string, error){p.System, p.Context, p.Editor} {
+		if _, err := render(sample); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Prompts) System(data *PromptData) (string, error) {
+	return render(p.system, data)
+}
+
+func (p *Prompts) Context(data *PromptData) (string, error) {
+	return render(p.context, data)
+}
+
+func (p *Prompts) Editor(data *PromptData) (string, error) {
+	return render(p.editor, data)
+}
+
+func render(tmpl *template.Template, data *PromptData) (string, error) {
+	var builder strings.Builder
+	if err := tmpl.Execute(&builder, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt template %s: %w", tmpl.Name(), err)
+	}
+	return strings.TrimSpace(builder.String()), nil
+}
@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aymenfurter/bicep-copilot/retrieval"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func goldenPromptData() *PromptData {
+	return &PromptData{
+		Corpus: "Azure/bicep-types-az",
+		User:   "octocat",
+		Docs: []*retrieval.Document{
+			{Path: "keyvault/vaults.md", Content: "# Microsoft.KeyVault/vaults\n\nenablePurgeProtection: bool"},
+			{Path: "storage/storageAccounts.md", Content: "# Microsoft.Storage/storageAccounts"},
+		},
+		Files: []EditorFile{
+			{Path: "infra/main.bicep", Content: "param location string"},
+			{Path: "infra/kv.bicep", Content: "resource kv 'Microsoft.KeyVault/vaults@2023-07-01' = {}", Selection: true},
+		},
+	}
+}
+
+func TestDefaultPromptsGolden(t *testing.T) {
+	prompts, err := LoadPrompts("")
+	if err != nil {
+		t.Fatalf("LoadPrompts() error = %v", err)
+	}
+
+	renderers := map[string]func(*PromptData) (string, error){
+		"system":  prompts.System,
+		"context": prompts.Context,
+		"editor":  prompts.Editor,
+	}
+
+	for name, render := range renderers {
+		got, err := render(goldenPromptData())
+		if err != nil {
+			t.Fatalf("%s render error = %v", name, err)
+		}
+
+		golden := filepath.Join("testdata", name+".golden")
+		if *update {
+			if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+				t.Fatalf("failed to update golden file: %v", err)
+			}
+		}
+
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatalf("failed to read golden file: %v", err)
+		}
+
+		if got != string(want) {
+			t.Errorf("%s prompt mismatch\ngot:\n%s\nwant:\n%s", name, got, want)
+		}
+	}
+}
+
+func TestLoadPromptsFromDir(t *testing.T) {
+	dir := t.TempDir()
+	custom := "Answer questions about {{.Corpus}} for {{.User}}."
+	if err := os.WriteFile(filepath.Join(dir, systemPromptName), []byte(custom), 0644); err != nil {
+		t.Fatalf("failed to write template: %v", err)
+	}
+
+	prompts, err := LoadPrompts(dir)
+	if err != nil {
+		t.Fatalf("LoadPrompts() error = %v", err)
+	}
+
+	got, err := prompts.System(goldenPromptData())
+	if err != nil {
+		t.Fatalf("System() error = %v", err)
+	}
+	if got != "Answer questions about Azure/bicep-types-az for octocat." {
+		t.Errorf("System() = %q", got)
+	}
+
+	context, err := prompts.Context(goldenPromptData())
+	if err != nil || !strings.Contains(context, "keyvault/vaults.md") {
+		t.Errorf("Context() = %q, %v, want default template output", context, err)
+	}
+}
+
+func TestLoadPromptsInvalid(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, contextPromptName), []byte("{{.Unknown}}"), 0644); err != nil {
+		t.Fatalf("failed to write template: %v", err)
+	}
+
+	if _, err := LoadPrompts(dir); err == nil {
+		t.Error("LoadPrompts() error = nil, want error for unknown field")
+	}
+}
+
+func TestLoadPromptsMissingDir(t *testing.T) {
+	if _, err := LoadPrompts(filepath.Join(t.TempDir(), "promts")); err == nil {
+		t.Error("LoadPrompts() error = nil, want error for a missing directory")
+	}
+}
@@ -0,0 +1,161 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/aymenfurter/bicep-copilot/copilot"
+)
+
+const sweepInterval = 5 * time.Minute
+
+type RateLimitOptions struct {
+	RequestsPerMinute float64
+	Burst             int
+	MaxConcurrent     int
+	ConcurrencyWait   time.Duration
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type rateLimiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+
+	slots           chan struct{}
+	concurrencyWait time.Duration
+}
+
+func newRateLimiter(opts RateLimitOptions) *rateLimiter {
+	l := &rateLimiter{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+	l.update(opts)
+	return l
+}
+
+func (l *rateLimiter) update(opts RateLimitOptions) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rate = opts.RequestsPerMinute / 60
+	l.burst = math.Max(1, float64(opts.Burst))
+	l.concurrencyWait = opts.ConcurrencyWait
+
+	// In-flight completions keep releasing into the channel they acquired
+	// from, so a resized cap only applies to new requests.
+	if opts.MaxConcurrent <= 0 {
+		l.slots = nil
+	} else if cap(l.slots) != opts.MaxConcurrent {
+		l.slots = make(chan struct{}, opts.MaxConcurrent)
+	}
+}
+
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rate <= 0 {
+		return true, 0
+	}
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func (l *rateLimiter) acquire(ctx context.Context) (func(), bool) {
+	l.mu.Lock()
+	slots, wait := l.slots, l.concurrencyWait
+	l.mu.Unlock()
+
+	if slots == nil {
+		return func() {}, true
+	}
+
+	release := func() { <-slots }
+	select {
+	case slots <- struct{}{}:
+		return release, true
+	default:
+	}
+
+	if wait <= 0 {
+		return nil, false
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case slots <- struct{}{}:
+		return release, true
+	case <-timer.C:
+		return nil, false
+	case <-ctx.Done():
+		return nil, false
+	}
+}
+
+func rateLimitedError(retryAfter time.Duration) copilot.Error {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	return copilot.Error{
+		Type:       copilot.ErrorTypeAgent,
+		Code:       "rate_limited",
+		Message:    fmt.Sprintf("You're sending requests faster than this deployment allows. Please try again in %d seconds.", seconds),
+		Identifier: "rate_limit",
+	}
+}
+
+func overloadedError() copilot.Error {
+	return copilot.Error{
+		Type:       copilot.ErrorTypeAgent,
+		Code:       "overloaded",
+		Message:    "Bicep Copilot is handling too many requests right now. Please try again in a few seconds.",
+		Identifier: "concurrency",
+	}
+}
@@ -0,0 +1,60 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterTokenBucket(t *testing.T) {
+	now := time.Now()
+	limiter := newRateLimiter(RateLimitOptions{RequestsPerMinute: 6, Burst: 2})
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := limiter.allow("octocat"); !ok {
+			t.Fatalf("allow() request %d = false, want true within burst", i)
+		}
+	}
+
+	ok, retryAfter := limiter.allow("octocat")
+	if ok {
+		t.Fatal("allow() after burst = true, want false")
+	}
+	if retryAfter != 10*time.Second {
+		t.Errorf("allow() retry after = %v, want 10s", retryAfter)
+	}
+
+	if ok, _ := limiter.allow("hubot"); !ok {
+		t.Error("allow() for another user = false, want true")
+	}
+
+	now = now.Add(10 * time.Second)
+	if ok, _ := limiter.allow("octocat"); !ok {
+		t.Error("allow() after refill = false, want true")
+	}
+}
+
+func TestRateLimiterConcurrency(t *testing.T) {
+	limiter := newRateLimiter(RateLimitOptions{MaxConcurrent: 1, ConcurrencyWait: 10 * time.Millisecond})
+
+	release, ok := limiter.acquire(context.Background())
+	if !ok {
+		t.Fatal("acquire() = false, want true")
+	}
+
+	if _, ok := limiter.acquire(context.Background()); ok {
+		t.Error("acquire() while full = true, want false")
+	}
+
+	release()
+	if release, ok := limiter.acquire(context.Background()); !ok {
+		t.Error("acquire() after release = false, want true")
+	} else {
+		release()
+	}
+
+	if ok, _ := newRateLimiter(RateLimitOptions{}).allow("octocat"); !ok {
+		t.Error("allow() with rate limiting disabled = false, want true")
+	}
+}
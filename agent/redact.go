@@ -0,0 +1,147 @@
+package agent
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/aymenfurter/bicep-copilot/copilot"
+)
+
+const (
+	minEntropyTokenLength = 32
+	minTokenEntropy       = 4.2
+)
+
+type secretPattern struct {
+	kind string
+	re   *regexp.Regexp
+	// group selects the submatch to replace, so keys like "AccountKey="
+	// stay readable; 0 replaces the whole match.
+	group int
+}
+
+var secretPatterns = []secretPattern{
+	{kind: "private-key", re: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{kind: "connection-string-secret", re: regexp.MustCompile(`(?i)\b(?:AccountKey|SharedAccessKey|SharedAccessSignature|Password|Pwd)\s*=\s*([^;"'\s$][^;"'\s]*)`), group: 1},
+	{kind: "sas-signature", re: regexp.MustCompile(`(?i)[?&]sig=([A-Za-z0-9%+/=]{16,})`), group: 1},
+	{kind: "entra-client-secret", re: regexp.MustCompile(`\b[A-Za-z0-9_~.\-]{3}\dQ~[A-Za-z0-9_~.\-]{31,34}\b`)},
+	{kind: "github-token", re: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{kind: "secret-literal", re: regexp.MustCompile(`(?i)\b\w*(?:password|secret|apikey|api_key|accesskey|access_key)['"]?(?:\s+string)?\s*[:=]\s*['"]([^'"\s$]{8,})['"]`), group: 1},
+}
+
+var (
+	entropyTokenPattern = regexp.MustCompile(`[A-Za-z0-9+/=_\-]{32,}`)
+	resourceIDPattern   = regexp.MustCompile(`(?i)^/subscriptions/[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}(?:/|$)`)
+)
+
+func redactSecrets(text string) (string, int) {
+	count := 0
+	for _, pattern := range secretPatterns {
+		var n int
+		text, n = replaceSubmatch(text, pattern)
+		count += n
+	}
+
+	text = entropyTokenPattern.ReplaceAllStringFunc(text, func(token string) string {
+		if !hasRandomSegment(token) {
+			return token
+		}
+		count++
+		return placeholder("high-entropy-string")
+	})
+
+	return text, count
+}
+
+func replaceSubmatch(text string, pattern secretPattern) (string, int) {
+	matches := pattern.re.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return text, 0
+	}
+
+	var builder strings.Builder
+	last := 0
+	for _, match := range matches {
+		start, end := match[2*pattern.group], match[2*pattern.group+1]
+		builder.WriteString(text[last:start])
+		builder.WriteString(placeholder(pattern.kind))
+		last = end
+	}
+	builder.WriteString(text[last:])
+	return builder.String(), len(matches)
+}
+
+func placeholder(kind string) string {
+	return "[REDACTED:" + kind + "]"
+}
+
+// hasRandomSegment checks each path segment on its own, so ARM resource IDs
+// and type names aren't mistaken for one long random token.
+func hasRandomSegment(token string) bool {
+	if resourceIDPattern.MatchString(token) {
+		return false
+	}
+	for _, segment := range strings.Split(token, "/") {
+		if looksRandom(segment) {
+			return true
+		}
+	}
+	return false
+}
+
+func looksRandom(token string) bool {
+	if len(token) < minEntropyTokenLength {
+		return false
+	}
+
+	hasDigit := strings.IndexFunc(token, func(r rune) bool { return r >= '0' && r <= '9' }) >= 0
+	hasLetter := strings.IndexFunc(token, func(r rune) bool { return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') }) >= 0
+	if !hasDigit || !hasLetter {
+		return false
+	}
+
+	return shannonEntropy(token) >= minTokenEntropy
+}
+
+func shannonEntropy(s string) float64 {
+	counts := make(map[rune]int)
+	for _, r := range s {
+		counts[r]++
+	}
+
+	entropy := 0.0
+	length := float64(len(s))
+	for _, n := range counts {
+		p := float64(n) / length
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+func redactMessages(messages []copilot.ChatMessage) int {
+	count := 0
+	for i := range messages {
+		var n int
+		messages[i].Content, n = redactSecrets(messages[i].Content)
+		count += n
+	}
+	return count
+}
+
+func redactFiles(files []EditorFile) int {
+	count := 0
+	for i := range files {
+		var n int
+		files[i].Content, n = redactSecrets(files[i].Content)
+		count += n
+	}
+	return count
+}
+
+func logf(format string, args ...interface{}) {
+	message, _ := redactSecrets(fmt.Sprintf(format, args...))
+	log.Print(message)
+}
@@ -0,0 +1,100 @@
+package agent
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/aymenfurter/bicep-copilot/copilot"
+)
+
+var resourceDeclPattern = regexp.MustCompile(`(?m)^\s*resource\s+\w+\s+'([A-Za-z0-9]+\.[A-Za-z0-9.]+/[A-Za-z0-9/]+)@([^']+)'`)
+
+type EditorFile struct {
+	Path      string
+	Content   string
+	Selection bool
+}
+
+func findEditorFiles(messages []copilot.ChatMessage) []EditorFile {
+	var files []EditorFile
+	seen := make(map[string]int)
+
+	for _, msg := range messages {
+		for _, ref := range msg.CopilotReferences {
+			file, ok := editorFileFromReference(ref)
+			if !ok {
+				continue
+			}
+
+			key := ref.Type + ":" + ref.ID
+			if idx, exists := seen[key]; exists {
+				files[idx] = file
+				continue
+			}
+			seen[key] = len(files)
+			files = append(files, file)
+		}
+	}
+
+	return files
+}
+
+func editorFileFromReference(ref copilot.Reference) (EditorFile, bool) {
+	switch ref.Type {
+	case copilot.ReferenceTypeClientFile:
+		data, ok := ref.File()
+		if !ok || data.Content == "" || !isBicep(ref.ID, data.Language) {
+			return EditorFile{}, false
+		}
+		return EditorFile{Path: ref.ID, Content: data.Content}, true
+	case copilot.ReferenceTypeClientSelection:
+		data, ok := ref.Selection()
+		if !ok || data.Content == "" || !isBicep(ref.ID, "") {
+			return EditorFile{}, false
+		}
+		return EditorFile{Path: ref.ID, Content: data.Content, Selection: true}, true
+	}
+	return EditorFile{}, false
+}
+
+func isBicep(filePath, language string) bool {
+	if strings.EqualFold(language, "bicep") {
+		return true
+	}
+	ext := strings.ToLower(path.Ext(filePath))
+	return ext == ".bicep" || ext == ".bicepparam"
+}
+
+func resourceTypes(files []EditorFile) []string {
+	var types []string
+	seen := make(map[string]bool)
+
+	for _, file := range files {
+		for _, match := range resourceDeclPattern.FindAllStringSubmatch(file.Content, -1) {
+			resourceType := match[1] + "@" + match[2]
+			if seen[resourceType] {
+				continue
+			}
+			seen[resourceType] = true
+			types = append(types, resourceType)
+		}
+	}
+
+	return types
+}
+
+func buildRetrievalQuery(userMessage string, types []string) string {
+	if len(types) == 0 {
+		return userMessage
+	}
+
+	var queryBuilder strings.Builder
+	queryBuilder.WriteString(userMessage)
+	if userMessage != "" {
+		queryBuilder.WriteString("\n\n")
+	}
+	queryBuilder.WriteString("Resource types: ")
+	queryBuilder.WriteString(strings.Join(types, ", "))
+	return queryBuilder.String()
+}
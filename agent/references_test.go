@@ -0,0 +1,69 @@
+package agent
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/aymenfurter/bicep-copilot/copilot"
+)
+
+const testBicep = `param location string = resourceGroup().location
+
+resource vault 'Microsoft.KeyVault/vaults@2023-07-01' = {
+  name: 'kv'
+  location: location
+}
+
+resource storage 'Microsoft.Storage/storageAccounts@2023-01-01' = {
+  name: 'st'
+  location: location
+}
+`
+
+func TestFindEditorFiles(t *testing.T) {
+	var req copilot.ChatRequest
+	payload := `{
+		"messages": [{
+			"role": "user",
+			"content": "how do I enable purge protection?",
+			"copilot_references": [
+				{"type": "client.file", "id": "infra/main.bicep", "is_implicit": true, "data": {"content": ` + jsonString(testBicep) + `, "language": "bicep"}},
+				{"type": "client.file", "id": "README.md", "data": {"content": "# readme", "language": "markdown"}},
+				{"type": "client.selection", "id": "infra/kv.bicep", "data": {"start": {"line": 1, "character": 0}, "end": {"line": 3, "character": 1}, "content": "resource kv 'Microsoft.KeyVault/vaults@2023-07-01' = {}"}}
+			]
+		}]
+	}`
+	if err := json.Unmarshal([]byte(payload), &req); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	files := findEditorFiles(req.Messages)
+	if len(files) != 2 {
+		t.Fatalf("findEditorFiles() got %d files, want 2", len(files))
+	}
+
+	if files[0].Path != "infra/main.bicep" || files[0].Selection {
+		t.Errorf("findEditorFiles() first file = %+v, want infra/main.bicep", files[0])
+	}
+
+	if !files[1].Selection {
+		t.Error("findEditorFiles() second file Selection = false, want true")
+	}
+
+	types := resourceTypes(files)
+	want := []string{"Microsoft.KeyVault/vaults@2023-07-01", "Microsoft.Storage/storageAccounts@2023-01-01"}
+	if strings.Join(types, ",") != strings.Join(want, ",") {
+		t.Errorf("resourceTypes() = %v, want %v", types, want)
+	}
+
+	query := buildRetrievalQuery("how do I enable purge protection?", types)
+	if !strings.Contains(query, "Microsoft.KeyVault/vaults@2023-07-01") {
+		t.Errorf("buildRetrievalQuery() = %q, want to contain resource type", query)
+	}
+}
+
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
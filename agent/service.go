@@ -1,37 +1,88 @@
 package agent
 
 import (
-	"bufio"
 	"context"
-	"crypto/ecdsa"
 	"crypto/sha256"
-	"encoding/asn1"
-	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"math/big"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
 
 	"github.com/aymenfurter/bicep-copilot/copilot"
+	"github.com/aymenfurter/bicep-copilot/identity"
 	"github.com/aymenfurter/bicep-copilot/retrieval"
+	"github.com/aymenfurter/bicep-copilot/usage"
 )
 
+const degradedNotice = "> **Note:** The Bicep documentation index is still being built, so this answer relies on the model's general knowledge and may not reflect the latest resource types or API versions.\n\n"
+
+type Retriever interface {
+	FindRelevantDocuments(ctx context.Context, query string) ([]*retrieval.Document, error)
+}
+
 type Service struct {
-	pubKey           *ecdsa.PublicKey
-	retrievalService *retrieval.Service
+	retrievalService Retriever
+	backend          copilot.ChatBackend
+	settings         atomic.Pointer[Settings]
+	usage            *usage.Recorder
+	answerCache      *AnswerCache
+	identity         *identity.Resolver
+	limiter          *rateLimiter
+	audit            *AuditLog
+}
+
+type Options struct {
+	Backend        copilot.ChatBackend
+	Prompts        *Prompts
+	Corpus         string
+	Model          copilot.Model
+	FallbackModels []copilot.Model
+	Usage          *usage.Recorder
+	AnswerCache    *AnswerCache
+
+	Sampling        copilot.SamplingParams
+	CommandSampling map[string]copilot.SamplingParams
+
+	Identity *identity.Resolver
+	Policy   identity.Policy
+
+	RateLimit RateLimitOptions
+	Audit     *AuditLog
 }
 
-func NewService(pubKey *ecdsa.PublicKey, retrievalService *retrieval.Service) *Service {
-	return &Service{
-		pubKey:           pubKey,
+func NewService(retrievalService Retriever, opts Options) *Service {
+	s := &Service{
 		retrievalService: retrievalService,
+		backend:          opts.Backend,
+		usage:            opts.Usage,
+		answerCache:      opts.AnswerCache,
+		identity:         opts.Identity,
+		limiter:          newRateLimiter(opts.RateLimit),
+		audit:            opts.Audit,
 	}
+	s.settings.Store(&Settings{
+		Prompts:         opts.Prompts,
+		Corpus:          opts.Corpus,
+		Model:           opts.Model,
+		FallbackModels:  opts.FallbackModels,
+		Sampling:        opts.Sampling,
+		CommandSampling: opts.CommandSampling,
+		Policy:          opts.Policy,
+		RateLimit:       opts.RateLimit,
+	})
+	return s
 }
 
 func (s *Service) ChatCompletion(w http.ResponseWriter, r *http.Request) {
-	sig := r.Header.Get("Github-Public-Key-Signature")
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		fmt.Printf("failed to read request body: %v\n", err)
@@ -39,17 +90,6 @@ func (s *Service) ChatCompletion(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	isValid, err := s.validPayload(body, sig)
-	if err != nil {
-		fmt.Printf("failed to validate payload signature: %v\n", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-	if !isValid {
-		http.Error(w, "invalid payload signature", http.StatusUnauthorized)
-		return
-	}
-
 	var req *copilot.ChatRequest
 	if err := json.Unmarshal(body, &req); err != nil {
 		fmt.Printf("failed to unmarshal request: %v\n", err)
@@ -60,10 +100,48 @@ func (s *Service) ChatCompletion(w http.ResponseWriter, r *http.Request) {
 	apiToken := r.Header.Get("X-GitHub-Token")
 	integrationID := r.Header.Get("Copilot-Integration-Id")
 
-	if err := s.generateCompletion(r.Context(), integrationID, apiToken, req, w); err != nil {
-		fmt.Printf("failed to execute agent: %v\n", err)
+	settings := s.settings.Load()
+	user, copilotErr := s.resolveUser(r.Context(), settings.Policy, apiToken)
+	if copilotErr != nil {
+		writeCopilotError(w, *copilotErr)
+		return
+	}
+
+	login := ""
+	userID := userKey(apiToken)
+	if user != nil {
+		login = user.Login
+		userID = user.Login
+	}
+
+	if allowed, retryAfter := s.limiter.allow(userID); !allowed {
+		log.Printf("Rate limited %s, retry after %v", userID, retryAfter)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		writeCopilotError(w, rateLimitedError(retryAfter))
+		return
+	}
+
+	release, ok := s.limiter.acquire(r.Context())
+	if !ok {
+		log.Printf("Rejected request from %s: too many concurrent completions", userID)
+		w.Header().Set("Retry-After", "5")
+		writeCopilotError(w, overloadedError())
+		return
+	}
+	defer release()
+
+	start := time.Now()
+	audit := &AuditRecord{User: userID, IntegrationID: integrationID}
+
+	ctx := usage.WithAttribution(r.Context(), userID, integrationID)
+	if err := s.generateCompletion(ctx, settings, integrationID, apiToken, login, req, w, audit); err != nil {
+		logf("failed to execute agent: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
+		audit.Error = err.Error()
 	}
+
+	audit.LatencyMS = time.Since(start).Milliseconds()
+	s.audit.Record(*audit)
 }
 
 func (s *Service) findLastUserMessage(messages []copilot.ChatMessage) string {
@@ -75,60 +153,182 @@ func (s *Service) findLastUserMessage(messages []copilot.ChatMessage) string {
 	return ""
 }
 
-func (s *Service) buildContextMessage(docs []*retrieval.Document) string {
-	var contextBuilder strings.Builder
-	contextBuilder.WriteString("Here is some relevant documentation to help answer the question:\n\n")
-	
+func (s *Service) buildContextMessage(prompts *Prompts, data *PromptData) (string, error) {
 	const maxContextLength = 100000
-	currentLength := contextBuilder.Len()
+	currentLength := 0
 
+	docs := data.Docs
+	data.Docs = nil
 	for _, doc := range docs {
-		additionalLen := len(doc.Path) + len(doc.Content) + 8 
-		if currentLength + additionalLen > maxContextLength {
+		additionalLen := len(doc.Path) + len(doc.Content) + 8
+		if currentLength+additionalLen > maxContextLength {
 			continue
 		}
 
-		contextBuilder.WriteString("From ")
-		contextBuilder.WriteString(doc.Path)
-		contextBuilder.WriteString(":\n")
-		contextBuilder.WriteString(doc.Content)
-		contextBuilder.WriteString("\n\n")
+		data.Docs = append(data.Docs, doc)
+		currentLength += additionalLen
+	}
+
+	return prompts.Context(data)
+}
+
+func (s *Service) buildEditorMessage(prompts *Prompts, data *PromptData) (string, error) {
+	const maxEditorLength = 50000
+	currentLength := 0
 
+	files := data.Files
+	data.Files = nil
+	for _, file := range files {
+		additionalLen := len(file.Path) + len(file.Content) + 32
+		if currentLength+additionalLen > maxEditorLength {
+			continue
+		}
+
+		data.Files = append(data.Files, file)
 		currentLength += additionalLen
 	}
 
-	return contextBuilder.String()
+	return prompts.Editor(data)
 }
 
-func (s *Service) processStream(stream io.ReadCloser, w io.Writer) error {
-	scanner := bufio.NewScanner(stream)
-	for scanner.Scan() {
-		if _, err := w.Write(scanner.Bytes()); err != nil {
-			return fmt.Errorf("failed to write to stream: %w", err)
+func (s *Service) processStream(stream io.ReadCloser, w io.Writer) (*copilot.ChatCompletion, []copilot.Event, error) {
+	decoder := copilot.NewStreamDecoder(stream)
+	aggregator := copilot.NewAggregator()
+	var events []copilot.Event
+
+	for {
+		event, err := decoder.NextEvent()
+		if err == io.EOF {
+			break
 		}
-		if _, err := w.Write([]byte("\n")); err != nil {
-			return fmt.Errorf("failed to write delimiter to stream: %w", err)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read from stream: %w", err)
+		}
+
+		if event.IsMessage() {
+			chunk, err := event.Chunk()
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to read from stream: %w", err)
+			}
+			aggregator.Add(chunk)
+		}
+		events = append(events, event)
+		if err := writeEvent(w, event); err != nil {
+			return nil, nil, err
 		}
 	}
 
-	if err := scanner.Err(); err != nil && err != io.EOF {
-		return fmt.Errorf("failed to read from stream: %w", err)
+	if err := copilot.WriteDone(w); err != nil {
+		return nil, nil, fmt.Errorf("failed to write to stream: %w", err)
+	}
+
+	return aggregator.Result(), events, nil
+}
+
+func (s *Service) replayEvents(events []copilot.Event, w io.Writer) error {
+	for _, event := range events {
+		if err := writeEvent(w, event); err != nil {
+			return err
+		}
+	}
+
+	if err := copilot.WriteDone(w); err != nil {
+		return fmt.Errorf("failed to write to stream: %w", err)
 	}
 	return nil
 }
 
-func (s *Service) generateCompletion(ctx context.Context, integrationID, apiToken string, req *copilot.ChatRequest, w io.Writer) error {
+func aggregateEvents(events []copilot.Event) *copilot.ChatCompletion {
+	aggregator := copilot.NewAggregator()
+	for _, event := range events {
+		var chunk copilot.ChatCompletionChunk
+		if err := json.Unmarshal([]byte(event.Data), &chunk); err == nil {
+			aggregator.Add(&chunk)
+		}
+	}
+	return aggregator.Result()
+}
+
+func writeEvent(w io.Writer, event copilot.Event) error {
+	if err := copilot.WriteEvent(w, event); err != nil {
+		return fmt.Errorf("failed to write to stream: %w", err)
+	}
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+func (s *Service) isCacheable(req *copilot.ChatRequest, data *PromptData) bool {
+	if s.answerCache == nil || len(data.Files) > 0 {
+		return false
+	}
+
+	userMessages := 0
+	for _, msg := range req.Messages {
+		if msg.Role == "user" {
+			userMessages++
+		}
+	}
+	return userMessages == 1
+}
+
+func (s *Service) generateCompletion(ctx context.Context, settings *Settings, integrationID, apiToken, login string, req *copilot.ChatRequest, w io.Writer, audit *AuditRecord) error {
 	var messages []copilot.ChatMessage
 
+	data := &PromptData{
+		Corpus: settings.Corpus,
+		User:   login,
+		Files:  findEditorFiles(req.Messages),
+	}
+
+	redactions := redactMessages(req.Messages) + redactFiles(data.Files)
+	if redactions > 0 {
+		log.Printf("Redacted %d secrets from request", redactions)
+	}
+
 	lastUserMessage := s.findLastUserMessage(req.Messages)
-	if lastUserMessage != "" {
-		docs, err := s.retrievalService.FindRelevantDocuments(ctx, lastUserMessage)
+	query := buildRetrievalQuery(lastUserMessage, resourceTypes(data.Files))
+	cacheModel := settings.modelChain(req.Model)[0]
+
+	audit.Question = lastUserMessage
+	audit.Redactions = redactions
+	audit.FlaggedMessages = screenMessages(req.Messages)
+
+	var cacheKey *AnswerKey
+	if query != "" && s.isCacheable(req, data) {
+		events, key, hit, err := s.answerCache.Lookup(ctx, query, cacheModel, login)
 		if err != nil {
+			logf("Answer cache lookup failed: %v", err)
+		} else if hit {
+			log.Printf("Answer cache hit, replaying %d events", len(events))
+			completion := aggregateEvents(events)
+			audit.Cached = true
+			audit.Model = completion.Model
+			audit.FinishReason = completion.FinishReason()
+			audit.Answer = completion.Content()
+			return s.replayEvents(events, w)
+		}
+		cacheKey = &key
+	}
+
+	if query != "" {
+		docs, err := s.retrievalService.FindRelevantDocuments(ctx, query)
+		switch {
+		case errors.Is(err, retrieval.ErrNotReady):
+			log.Printf("Document index not ready, answering without retrieved documentation")
+			audit.Degraded = true
+		case err != nil:
 			return fmt.Errorf("error finding relevant documents: %w", err)
 		}
+		data.Docs = screenDocuments(docs)
 
-		if len(docs) > 0 {
-			contextMessage := s.buildContextMessage(docs)
+		if len(data.Docs) > 0 {
+			contextMessage, err := s.buildContextMessage(settings.Prompts, data)
+			if err != nil {
+				return err
+			}
+			audit.Sources = auditSources(data.Docs)
 			messages = append(messages, copilot.ChatMessage{
 				Role:    "system",
 				Content: contextMessage,
@@ -136,44 +336,131 @@ func (s *Service) generateCompletion(ctx context.Context, integrationID, apiToke
 		}
 	}
 
-	messages = append(messages, req.Messages...)
+	if len(data.Files) > 0 {
+		editorMessage, err := s.buildEditorMessage(settings.Prompts, data)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, copilot.ChatMessage{
+			Role:    "system",
+			Content: editorMessage,
+		})
+	}
+
+	for _, msg := range req.Messages {
+		messages = append(messages, copilot.ChatMessage{
+			Role:    msg.Role,
+			Content: msg.Content,
+			Name:    msg.Name,
+		})
+	}
+
+	systemMessage, err := settings.Prompts.System(data)
+	if err != nil {
+		return err
+	}
 	messages = append(messages, copilot.ChatMessage{
 		Role:    "system",
-		Content: "Based on the provided documentation, answer the user's question about Bicep. If you're unsure about something, acknowledge that and suggest looking at the official documentation. At the end give citations of the used resource names and versions. You may also link to docs. For instance for Microsoft.Storage/storageAccounts/queueServices/queues@2021-06-01 you may link to https://learn.microsoft.com/en-us/azure/templates/microsoft.storage/2021-06-01/storageaccounts/queueservices/queues?pivots=deployment-language-bicep - In citations use emojis.",
+		Content: systemMessage,
 	})
 
 	chatReq := &copilot.ChatCompletionsRequest{
-		Model:    copilot.ModelGPT4,
 		Messages: messages,
 		Stream:   true,
+		StreamOptions: &copilot.StreamOptions{
+			IncludeUsage: true,
+		},
+		SamplingParams: settings.samplingFor(lastUserMessage),
 	}
 
-	stream, err := copilot.ChatCompletions(ctx, integrationID, apiToken, chatReq)
+	stream, err := s.completeWithFallback(ctx, settings.modelChain(req.Model), integrationID, apiToken, chatReq)
 	if err != nil {
 		return fmt.Errorf("failed to get chat completion stream: %w", err)
 	}
 	defer stream.Close()
 
-	return s.processStream(stream, w)
+	if audit.Degraded {
+		if err := writeEvent(w, copilot.ContentEvent(degradedNotice)); err != nil {
+			return err
+		}
+	}
+
+	completion, events, err := s.processStream(stream, w)
+	if err != nil {
+		return err
+	}
+
+	audit.Model = completion.Model
+	audit.FinishReason = completion.FinishReason()
+	audit.Answer = completion.Content()
+
+	if cacheKey != nil && !audit.Degraded && completion.FinishReason() == "stop" {
+		s.answerCache.Store(*cacheKey, events)
+	}
+
+	log.Printf("Completion %s finished: model=%s finish_reason=%s length=%d redactions=%d", completion.ID, completion.Model, completion.FinishReason(), len(completion.Content()), redactions)
+	s.recordCompletionUsage(ctx, completion)
+	return nil
 }
 
-type asn1Signature struct {
-	R *big.Int
-	S *big.Int
+func (s *Service) recordCompletionUsage(ctx context.Context, completion *copilot.ChatCompletion) {
+	attribution := usage.AttributionFrom(ctx)
+	record := usage.Record{
+		User:          attribution.User,
+		IntegrationID: attribution.IntegrationID,
+		Kind:          usage.KindCompletion,
+		Model:         completion.Model,
+	}
+	if completion.Usage != nil {
+		record.PromptTokens = completion.Usage.PromptTokens
+		record.CompletionTokens = completion.Usage.CompletionTokens
+		record.TotalTokens = completion.Usage.TotalTokens
+	}
+	s.usage.Record(record)
 }
 
-func (s *Service) validPayload(data []byte, sig string) (bool, error) {
-	asnSig, err := base64.StdEncoding.DecodeString(sig)
-	if err != nil {
-		return false, fmt.Errorf("failed to decode signature: %w", err)
+func userKey(apiToken string) string {
+	if apiToken == "" {
+		return "anonymous"
 	}
+	digest := sha256.Sum256([]byte(apiToken))
+	return "token:" + hex.EncodeToString(digest[:6])
+}
 
-	parsedSig := asn1Signature{}
-	rest, err := asn1.Unmarshal(asnSig, &parsedSig)
-	if err != nil || len(rest) != 0 {
-		return false, fmt.Errorf("failed to parse signature: %w", err)
+func slashCommand(message string) (string, bool) {
+	message = strings.TrimSpace(message)
+	if !strings.HasPrefix(message, "/") {
+		return "", false
 	}
 
-	digest := sha256.Sum256(data)
-	return ecdsa.Verify(s.pubKey, digest[:], parsedSig.R, parsedSig.S), nil
-}
\ No newline at end of file
+	command := strings.TrimPrefix(message, "/")
+	if i := strings.IndexFunc(command, unicode.IsSpace); i >= 0 {
+		command = command[:i]
+	}
+	if command == "" {
+		return "", false
+	}
+	return strings.ToLower(command), true
+}
+
+func (s *Service) completeWithFallback(ctx context.Context, models []copilot.Model, integrationID, apiToken string, chatReq *copilot.ChatCompletionsRequest) (io.ReadCloser, error) {
+	var lastErr error
+	for _, model := range models {
+		chatReq.Model = model
+
+		stream, err := s.backend.ChatCompletions(ctx, integrationID, apiToken, chatReq)
+		if err == nil {
+			log.Printf("Completion answered by model %s", model)
+			return stream, nil
+		}
+
+		if !copilot.IsModelUnavailable(err) && !copilot.IsServerError(err) {
+			return nil, err
+		}
+
+		logf("Model %s failed, trying next fallback: %v", model, err)
+		lastErr = err
+	}
+
+	return nil, fmt.Errorf("all models failed: %w", lastErr)
+}
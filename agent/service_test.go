@@ -0,0 +1,443 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aymenfurter/bicep-copilot/copilot"
+	"github.com/aymenfurter/bicep-copilot/copilottest"
+	"github.com/aymenfurter/bicep-copilot/identity"
+	"github.com/aymenfurter/bicep-copilot/retrieval"
+	"github.com/aymenfurter/bicep-copilot/signature"
+)
+
+type fakeRetriever struct {
+	docs    []*retrieval.Document
+	err     error
+	queries []string
+}
+
+func (f *fakeRetriever) FindRelevantDocuments(ctx context.Context, query string) ([]*retrieval.Document, error) {
+	f.queries = append(f.queries, query)
+	return f.docs, f.err
+}
+
+func newTestHandler(t *testing.T, server *copilottest.Server, signer *copilottest.Signer, retriever Retriever, opts Options) http.Handler {
+	t.Helper()
+
+	prompts, err := LoadPrompts("")
+	if err != nil {
+		t.Fatalf("LoadPrompts() error = %v", err)
+	}
+
+	opts.Backend = server.CopilotClient()
+	opts.Prompts = prompts
+	keys := signature.NewStaticKeySet(map[string]*ecdsa.PublicKey{signer.KeyID: signer.PublicKey()}, signer.KeyID)
+	s := NewService(retriever, opts)
+	return signature.Middleware(keys, signature.MiddlewareOptions{})(http.HandlerFunc(s.ChatCompletion))
+}
+
+func expectedStream(t *testing.T, resp copilottest.Response) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	for _, event := range resp.Events {
+		if err := copilot.WriteEvent(&buf, event); err != nil {
+			t.Fatalf("WriteEvent() error = %v", err)
+		}
+	}
+	return buf.String()
+}
+
+func TestModelChain(t *testing.T) {
+	s := NewService(nil, Options{
+		Model:          copilot.ModelGPT41,
+		FallbackModels: []copilot.Model{copilot.ModelGPT4o, copilot.ModelGPT41, copilot.ModelGPT4oMini},
+	})
+
+	got := s.settings.Load().modelChain(copilot.ModelClaude35Sonnet)
+	want := []copilot.Model{copilot.ModelClaude35Sonnet, copilot.ModelGPT41, copilot.ModelGPT4o, copilot.ModelGPT4oMini}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("modelChain() = %v, want %v", got, want)
+	}
+
+	defaults := NewService(nil, Options{}).settings.Load().modelChain("")
+	if !reflect.DeepEqual(defaults, []copilot.Model{copilot.DefaultModel}) {
+		t.Errorf("modelChain() without config = %v, want [%v]", defaults, copilot.DefaultModel)
+	}
+}
+
+func TestChatCompletionStreamsAnswer(t *testing.T) {
+	signer, err := copilottest.NewSigner()
+	if err != nil {
+		t.Fatalf("NewSigner() error = %v", err)
+	}
+
+	answer := copilottest.ContentStream("gpt-4o", "Use ", "2023-07-01 ", "for Key Vault.")
+	server := copilottest.NewServer(answer)
+	defer server.Close()
+
+	retriever := &fakeRetriever{docs: []*retrieval.Document{
+		{Path: "keyvault/vaults.md", Content: "# Microsoft.KeyVault/vaults"},
+	}}
+	handler := newTestHandler(t, server, signer, retriever, Options{Corpus: "Azure/bicep-types-az"})
+
+	payload := []byte(`{"messages":[{"role":"user","content":"latest apiVersion for Key Vault?"}]}`)
+	req, err := signer.NewRequest("/agent", payload)
+	if err != nil {
+		t.Fatalf("NewRequest() error = %v", err)
+	}
+	req.Header.Set("X-GitHub-Token", "user-token")
+	req.Header.Set("Copilot-Integration-Id", "vscode-chat")
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("ChatCompletion() status = %d, want 200", w.Code)
+	}
+	if got, want := w.Body.String(), expectedStream(t, answer); got != want {
+		t.Errorf("ChatCompletion() body =\n%s\nwant:\n%s", got, want)
+	}
+
+	requests := server.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("upstream received %d requests, want 1", len(requests))
+	}
+	upstream := requests[0]
+	if upstream.Header.Get("Authorization") != "Bearer user-token" {
+		t.Errorf("upstream Authorization = %q", upstream.Header.Get("Authorization"))
+	}
+	if upstream.Header.Get("Copilot-Integration-Id") != "vscode-chat" {
+		t.Errorf("upstream Copilot-Integration-Id = %q", upstream.Header.Get("Copilot-Integration-Id"))
+	}
+
+	messages := upstream.Body.Messages
+	if len(messages) != 3 {
+		t.Fatalf("upstream got %d messages, want 3", len(messages))
+	}
+	if messages[0].Role != "system" || !strings.Contains(messages[0].Content, "keyvault/vaults.md") {
+		t.Errorf("upstream context message = %+v", messages[0])
+	}
+	if messages[1].Role != "user" || messages[1].Content != "latest apiVersion for Key Vault?" {
+		t.Errorf("upstream user message = %+v", messages[1])
+	}
+	if !strings.Contains(messages[2].Content, "Azure/bicep-types-az") {
+		t.Errorf("upstream system prompt = %q, want corpus name", messages[2].Content)
+	}
+
+	if len(retriever.queries) != 1 || retriever.queries[0] != "latest apiVersion for Key Vault?" {
+		t.Errorf("retrieval queries = %v", retriever.queries)
+	}
+}
+
+func TestChatCompletionForwardsNamedEvents(t *testing.T) {
+	signer, _ := copilottest.NewSigner()
+
+	answer := copilottest.ContentStream("gpt-4o", "See ", "the reference.")
+	references := copilot.Event{Name: "copilot_references", Data: `[{"type":"doc","id":"keyvault"}]`}
+	answer.Events = append([]copilot.Event{answer.Events[0], references}, answer.Events[1:]...)
+	server := copilottest.NewServer(answer)
+	defer server.Close()
+
+	handler := newTestHandler(t, server, signer, &fakeRetriever{}, Options{})
+
+	req, _ := signer.NewRequest("/agent", []byte(`{"messages":[{"role":"user","content":"hi"}]}`))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if got, want := w.Body.String(), expectedStream(t, answer); got != want {
+		t.Errorf("ChatCompletion() body =\n%s\nwant:\n%s", got, want)
+	}
+	if !strings.Contains(w.Body.String(), "event: copilot_references\n") {
+		t.Error("ChatCompletion() dropped the named copilot_references event")
+	}
+}
+
+func TestChatCompletionFallsBackOnServerError(t *testing.T) {
+	signer, err := copilottest.NewSigner()
+	if err != nil {
+		t.Fatalf("NewSigner() error = %v", err)
+	}
+
+	answer := copilottest.ContentStream("gpt-4o-mini", "fallback answer")
+	server := copilottest.NewServer(copilottest.ErrorResponse(http.StatusBadGateway, "upstream down"), answer)
+	defer server.Close()
+
+	handler := newTestHandler(t, server, signer, &fakeRetriever{}, Options{
+		Model:          copilot.ModelGPT4o,
+		FallbackModels: []copilot.Model{copilot.ModelGPT4oMini},
+	})
+
+	payload := []byte(`{"messages":[{"role":"user","content":"hi"}]}`)
+	req, _ := signer.NewRequest("/agent", payload)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if got, want := w.Body.String(), expectedStream(t, answer); got != want {
+		t.Errorf("ChatCompletion() body =\n%s\nwant:\n%s", got, want)
+	}
+
+	requests := server.Requests()
+	if len(requests) != 2 || requests[0].Body.Model != copilot.ModelGPT4o || requests[1].Body.Model != copilot.ModelGPT4oMini {
+		t.Errorf("upstream models = %v, want [gpt-4o gpt-4o-mini]", requests)
+	}
+}
+
+func TestChatCompletionRejectsInvalidSignature(t *testing.T) {
+	signer, _ := copilottest.NewSigner()
+	other, _ := copilottest.NewSigner()
+
+	server := copilottest.NewServer()
+	defer server.Close()
+
+	handler := newTestHandler(t, server, signer, &fakeRetriever{}, Options{})
+
+	payload := []byte(`{"messages":[{"role":"user","content":"hi"}]}`)
+	req, _ := other.NewRequest("/agent", payload)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("ChatCompletion() status = %d, want 401", w.Code)
+	}
+	if len(server.Requests()) != 0 {
+		t.Error("ChatCompletion() called upstream for an invalid signature")
+	}
+}
+
+func TestChatCompletionReplaysCachedAnswer(t *testing.T) {
+	signer, _ := copilottest.NewSigner()
+
+	answer := copilottest.ContentStream("gpt-4o", "Use ", "2023-07-01.")
+	server := copilottest.NewServer(answer)
+	defer server.Close()
+
+	embedder := &fakeEmbedder{
+		version:    "v1",
+		embeddings: map[string][]float32{"latest apiVersion for Key Vault?": {1, 0}},
+	}
+	handler := newTestHandler(t, server, signer, &fakeRetriever{}, Options{
+		AnswerCache: NewAnswerCache(embedder, AnswerCacheOptions{TTL: time.Hour}),
+	})
+
+	payload := []byte(`{"messages":[{"role":"user","content":"latest apiVersion for Key Vault?"}]}`)
+	for i := 0; i < 2; i++ {
+		req, _ := signer.NewRequest("/agent", payload)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if got, want := w.Body.String(), expectedStream(t, answer); got != want {
+			t.Errorf("ChatCompletion() request %d body =\n%s\nwant:\n%s", i, got, want)
+		}
+	}
+
+	if got := len(server.Requests()); got != 1 {
+		t.Errorf("upstream received %d requests, want 1", got)
+	}
+}
+
+func TestSamplingForSlashCommand(t *testing.T) {
+	defaultTemperature, lookupTemperature, maxTokens := 0.7, 0.0, 800
+	s := NewService(nil, Options{
+		Sampling: copilot.SamplingParams{Temperature: &defaultTemperature, MaxTokens: &maxTokens},
+		CommandSampling: map[string]copilot.SamplingParams{
+			"lookup": {Temperature: &lookupTemperature},
+		},
+	})
+
+	params := s.settings.Load().samplingFor("/lookup latest apiVersion for Key Vault")
+	if params.Temperature == nil || *params.Temperature != 0 {
+		t.Errorf("samplingFor(/lookup) temperature = %v, want 0", params.Temperature)
+	}
+	if params.MaxTokens == nil || *params.MaxTokens != 800 {
+		t.Errorf("samplingFor(/lookup) max tokens = %v, want deployment default 800", params.MaxTokens)
+	}
+
+	params = s.settings.Load().samplingFor("explain modules")
+	if params.Temperature == nil || *params.Temperature != 0.7 {
+		t.Errorf("samplingFor() temperature = %v, want 0.7", params.Temperature)
+	}
+
+	if _, ok := slashCommand("/ "); ok {
+		t.Error("slashCommand(\"/ \") ok = true, want false")
+	}
+}
+
+func TestChatCompletionDeniesUsersOutsidePolicy(t *testing.T) {
+	signer, _ := copilottest.NewSigner()
+
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/user":
+			w.Write([]byte(`{"id":2,"login":"mallory"}`))
+		case "/user/orgs":
+			w.Write([]byte(`[{"login":"fabrikam"}]`))
+		default:
+			w.Write([]byte(`[]`))
+		}
+	}))
+	defer github.Close()
+
+	server := copilottest.NewServer()
+	defer server.Close()
+
+	policy := identity.Policy{Orgs: []string{"contoso"}}
+	handler := newTestHandler(t, server, signer, &fakeRetriever{}, Options{
+		Identity: identity.NewResolver(identity.ResolverOptions{BaseURL: github.URL, ResolveMemberships: true}),
+		Policy:   policy,
+	})
+
+	req, _ := signer.NewRequest("/agent", []byte(`{"messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("X-GitHub-Token", "gho_mallory")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	body := w.Body.String()
+	if !strings.HasPrefix(body, "event: copilot_errors\n") || !strings.Contains(body, `"code":"access_denied"`) {
+		t.Errorf("ChatCompletion() body = %q, want copilot_errors access_denied event", body)
+	}
+	if len(server.Requests()) != 0 {
+		t.Error("ChatCompletion() called upstream for a denied user")
+	}
+}
+
+func TestChatCompletionRateLimited(t *testing.T) {
+	signer, _ := copilottest.NewSigner()
+
+	answer := copilottest.ContentStream("gpt-4o", "ok")
+	server := copilottest.NewServer(answer)
+	defer server.Close()
+
+	handler := newTestHandler(t, server, signer, &fakeRetriever{}, Options{
+		RateLimit: RateLimitOptions{RequestsPerMinute: 1, Burst: 1},
+	})
+
+	payload := []byte(`{"messages":[{"role":"user","content":"hi"}]}`)
+	var last *httptest.ResponseRecorder
+	for i := 0; i < 2; i++ {
+		req, _ := signer.NewRequest("/agent", payload)
+		req.Header.Set("X-GitHub-Token", "user-token")
+		last = httptest.NewRecorder()
+		handler.ServeHTTP(last, req)
+	}
+
+	if !strings.Contains(last.Body.String(), `"code":"rate_limited"`) {
+		t.Errorf("second request body = %q, want rate_limited error event", last.Body.String())
+	}
+	if last.Header().Get("Retry-After") != "60" {
+		t.Errorf("Retry-After = %q, want 60", last.Header().Get("Retry-After"))
+	}
+	if len(server.Requests()) != 1 {
+		t.Errorf("upstream received %d requests, want 1", len(server.Requests()))
+	}
+}
+
+func TestChatCompletionRedactsSecrets(t *testing.T) {
+	signer, _ := copilottest.NewSigner()
+
+	server := copilottest.NewServer(copilottest.ContentStream("gpt-4o", "ok"))
+	defer server.Close()
+
+	retriever := &fakeRetriever{}
+	handler := newTestHandler(t, server, signer, retriever, Options{})
+
+	const accountKey = "c2VjcmV0a2V5c2VjcmV0a2V5c2VjcmV0a2V5=="
+	payload := []byte(`{"messages":[{"role":"user","content":"why does AccountKey=` + accountKey + ` fail?"}]}`)
+	req, _ := signer.NewRequest("/agent", payload)
+	req.Header.Set("X-GitHub-Token", "user-token")
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	requests := server.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("upstream received %d requests, want 1", len(requests))
+	}
+	for _, msg := range requests[0].Body.Messages {
+		if strings.Contains(msg.Content, accountKey) {
+			t.Errorf("upstream %s message contains the account key", msg.Role)
+		}
+	}
+	for _, query := range retriever.queries {
+		if strings.Contains(query, accountKey) {
+			t.Errorf("retrieval query %q contains the account key", query)
+		}
+	}
+}
+
+func TestChatCompletionWritesAuditRecord(t *testing.T) {
+	signer, _ := copilottest.NewSigner()
+
+	server := copilottest.NewServer(copilottest.ContentStream("gpt-4o", "Use ", "2023-07-01."))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "audit.ndjson")
+	audit, err := NewAuditLog(AuditOptions{Path: path, UserSalt: "salt"})
+	if err != nil {
+		t.Fatalf("NewAuditLog() error = %v", err)
+	}
+
+	retriever := &fakeRetriever{docs: []*retrieval.Document{
+		{Path: "keyvault/vaults.md", Content: "# Microsoft.KeyVault/vaults", Score: 0.91},
+	}}
+	handler := newTestHandler(t, server, signer, retriever, Options{Audit: audit})
+
+	req, _ := signer.NewRequest("/agent", []byte(`{"messages":[{"role":"user","content":"latest apiVersion for Key Vault?"}]}`))
+	req.Header.Set("X-GitHub-Token", "user-token")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	audit.Close()
+
+	records := readAuditRecords(t, path)
+	if len(records) != 1 {
+		t.Fatalf("audit log has %d records, want 1", len(records))
+	}
+	rec := records[0]
+	if rec.Question != "latest apiVersion for Key Vault?" || rec.Answer != "Use 2023-07-01." || rec.Model != "gpt-4o" {
+		t.Errorf("audit record = %+v", rec)
+	}
+	if len(rec.Sources) != 1 || rec.Sources[0].Path != "keyvault/vaults.md" || rec.Sources[0].Score != 0.91 {
+		t.Errorf("audit sources = %+v", rec.Sources)
+	}
+}
+
+func TestChatCompletionDegradedWhileIndexing(t *testing.T) {
+	signer, _ := copilottest.NewSigner()
+
+	answer := copilottest.ContentStream("gpt-4o", "Use a storage account resource.")
+	server := copilottest.NewServer(answer)
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "audit.ndjson")
+	audit, err := NewAuditLog(AuditOptions{Path: path, UserSalt: "salt"})
+	if err != nil {
+		t.Fatalf("NewAuditLog() error = %v", err)
+	}
+
+	handler := newTestHandler(t, server, signer, &fakeRetriever{err: retrieval.ErrNotReady}, Options{Audit: audit})
+
+	req, _ := signer.NewRequest("/agent", []byte(`{"messages":[{"role":"user","content":"How do I declare a storage account?"}]}`))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	audit.Close()
+
+	var notice bytes.Buffer
+	if err := copilot.WriteEvent(&notice, copilot.ContentEvent(degradedNotice)); err != nil {
+		t.Fatalf("WriteEvent() error = %v", err)
+	}
+	if got, want := w.Body.String(), notice.String()+expectedStream(t, answer); got != want {
+		t.Errorf("ChatCompletion() body =\n%s\nwant:\n%s", got, want)
+	}
+
+	records := readAuditRecords(t, path)
+	if len(records) != 1 || !records[0].Degraded || records[0].Error != "" {
+		t.Errorf("audit records = %+v, want one degraded answer", records)
+	}
+}
@@ -0,0 +1,76 @@
+package agent
+
+import (
+	"slices"
+
+	"github.com/aymenfurter/bicep-copilot/copilot"
+	"github.com/aymenfurter/bicep-copilot/identity"
+)
+
+type Settings struct {
+	Prompts        *Prompts
+	Corpus         string
+	Model          copilot.Model
+	FallbackModels []copilot.Model
+
+	Sampling        copilot.SamplingParams
+	CommandSampling map[string]copilot.SamplingParams
+
+	Policy    identity.Policy
+	RateLimit RateLimitOptions
+}
+
+func (s *Service) Settings() Settings {
+	return *s.settings.Load()
+}
+
+func (s *Service) Reload(settings Settings) {
+	previous := s.settings.Load()
+	if settings.Prompts == nil {
+		settings.Prompts = previous.Prompts
+	}
+	if s.answerCache != nil && changesAnswers(previous, &settings) {
+		s.answerCache.Invalidate()
+	}
+
+	s.limiter.update(settings.RateLimit)
+	if s.identity != nil {
+		s.identity.SetResolveMemberships(settings.Policy.NeedsMemberships())
+	}
+	s.settings.Store(&settings)
+}
+
+func changesAnswers(previous, next *Settings) bool {
+	return next.Prompts != previous.Prompts ||
+		next.Corpus != previous.Corpus ||
+		!slices.Equal(previous.modelChain(""), next.modelChain(""))
+}
+
+func (s *Settings) samplingFor(userMessage string) copilot.SamplingParams {
+	params := s.Sampling
+	if command, ok := slashCommand(userMessage); ok {
+		if override, exists := s.CommandSampling[command]; exists {
+			params = params.Merge(override)
+		}
+	}
+	return params
+}
+
+func (s *Settings) modelChain(requested copilot.Model) []copilot.Model {
+	primary := s.Model
+	if primary == "" {
+		primary = copilot.DefaultModel
+	}
+
+	candidates := append([]copilot.Model{requested, primary}, s.FallbackModels...)
+	chain := make([]copilot.Model, 0, len(candidates))
+	seen := make(map[copilot.Model]bool)
+	for _, model := range candidates {
+		if model == "" || seen[model] {
+			continue
+		}
+		seen[model] = true
+		chain = append(chain, model)
+	}
+	return chain
+}
@@ -0,0 +1,95 @@
+package agent
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aymenfurter/bicep-copilot/copilot"
+)
+
+func TestServiceReload(t *testing.T) {
+	prompts, err := LoadPrompts("")
+	if err != nil {
+		t.Fatalf("LoadPrompts() error = %v", err)
+	}
+
+	s := NewService(nil, Options{
+		Prompts:   prompts,
+		Model:     copilot.ModelGPT4o,
+		RateLimit: RateLimitOptions{MaxConcurrent: 1},
+	})
+
+	release, ok := s.limiter.acquire(context.Background())
+	if !ok {
+		t.Fatal("acquire() = false, want true")
+	}
+	defer release()
+
+	s.Reload(Settings{
+		Model:          copilot.ModelGPT41,
+		FallbackModels: []copilot.Model{copilot.ModelGPT4oMini},
+		RateLimit:      RateLimitOptions{MaxConcurrent: 2},
+	})
+
+	settings := s.Settings()
+	if settings.Prompts != prompts {
+		t.Error("Reload() without prompts replaced the loaded templates")
+	}
+	if got, want := settings.modelChain(""), []copilot.Model{copilot.ModelGPT41, copilot.ModelGPT4oMini}; !reflect.DeepEqual(got, want) {
+		t.Errorf("modelChain() after Reload() = %v, want %v", got, want)
+	}
+
+	for i := 0; i < 2; i++ {
+		release, ok := s.limiter.acquire(context.Background())
+		if !ok {
+			t.Fatalf("acquire() %d after raising the cap = false, want true", i)
+		}
+		defer release()
+	}
+}
+
+func TestServiceReloadInvalidatesAnswerCache(t *testing.T) {
+	prompts, err := LoadPrompts("")
+	if err != nil {
+		t.Fatalf("LoadPrompts() error = %v", err)
+	}
+
+	embedder := &fakeEmbedder{
+		version:    "v1",
+		embeddings: map[string][]float32{"latest apiVersion for Key Vault": {1, 0}},
+	}
+	cache := NewAnswerCache(embedder, AnswerCacheOptions{TTL: time.Hour})
+	s := NewService(nil, Options{Prompts: prompts, Model: copilot.ModelGPT4o, AnswerCache: cache})
+
+	store := func() {
+		_, key, _, _ := cache.Lookup(context.Background(), "latest apiVersion for Key Vault", copilot.ModelGPT4o, "octocat")
+		cache.Store(key, []copilot.Event{{Data: "{}"}})
+	}
+	cached := func() bool {
+		_, _, hit, _ := cache.Lookup(context.Background(), "latest apiVersion for Key Vault", copilot.ModelGPT4o, "octocat")
+		return hit
+	}
+
+	store()
+	s.Reload(Settings{Model: copilot.ModelGPT4o, RateLimit: RateLimitOptions{MaxConcurrent: 1}})
+	if !cached() {
+		t.Error("Reload() with the same prompts and models dropped cached answers")
+	}
+
+	otherPrompts, err := LoadPrompts("")
+	if err != nil {
+		t.Fatalf("LoadPrompts() error = %v", err)
+	}
+	s.Reload(Settings{Prompts: otherPrompts, Model: copilot.ModelGPT4o})
+	if cached() {
+		t.Error("Reload() with new prompt templates kept cached answers")
+	}
+
+	store()
+	s.Reload(Settings{Model: copilot.ModelGPT4o, FallbackModels: []copilot.Model{copilot.ModelGPT4oMini}})
+	if cached() {
+		t.Error("Reload() with a new model chain kept cached answers")
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/aymenfurter/bicep-copilot/config"
+)
+
+const configUsage = "usage: bicep-copilot config check"
+
+func runConfigCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) != 1 || args[0] != "check" {
+		fmt.Fprintln(stderr, configUsage)
+		return 2
+	}
+
+	cfg, err := config.Resolve()
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	file := cfg.File()
+	if file == "" {
+		file = "(none)"
+	}
+	fmt.Fprintf(stdout, "Config file: %s\n\n", file)
+
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SETTING\tENV\tVALUE\tSOURCE")
+	for _, setting := range cfg.Settings() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", setting.Path, setting.Env, setting.Value, setting.Source)
+	}
+	tw.Flush()
+
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(stderr, "\n%v\n", err)
+		return 1
+	}
+
+	fmt.Fprintln(stdout, "\nConfiguration is valid.")
+	return 0
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/aymenfurter/bicep-copilot/copilot"
+	"github.com/aymenfurter/bicep-copilot/copilottest"
+	"github.com/aymenfurter/bicep-copilot/signature"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	agentURL := flag.String("url", "http://localhost:8080/agent", "agent endpoint")
+	keyPath := flag.String("key", "", "development signing key (defaults to DEV_SIGNING_KEY_PATH or ~/.bicep-copilot/dev-signing-key.pem)")
+	token := flag.String("token", os.Getenv("GITHUB_TOKEN"), "GitHub token sent as X-GitHub-Token")
+	model := flag.String("model", "", "model to request")
+	flag.Parse()
+
+	message := strings.Join(flag.Args(), " ")
+	if message == "" {
+		return fmt.Errorf("usage: devclient [flags] <message>")
+	}
+
+	if *keyPath == "" {
+		*keyPath = os.Getenv("DEV_SIGNING_KEY_PATH")
+	}
+	if *keyPath == "" {
+		*keyPath = signature.DefaultDevKeyPath()
+	}
+
+	key, err := signature.LoadDevKey(*keyPath)
+	if err != nil {
+		return fmt.Errorf("failed to load signing key (start the server with ENVIRONMENT=development first): %w", err)
+	}
+	signer, err := copilottest.NewSignerFromKey(key)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(copilot.ChatRequest{
+		Messages: []copilot.ChatMessage{{Role: "user", Content: message}},
+		Model:    copilot.Model(*model),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := signer.NewRequest(*agentURL, payload)
+	if err != nil {
+		return err
+	}
+	if *token != "" {
+		req.Header.Set("X-GitHub-Token", *token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("agent returned %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+
+	return printStream(resp.Body)
+}
+
+func printStream(r io.Reader) error {
+	decoder := copilot.NewStreamDecoder(r)
+	for {
+		event, err := decoder.NextEvent()
+		if errors.Is(err, io.EOF) {
+			fmt.Println()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch event.Name {
+		case "", "message":
+			var chunk copilot.ChatCompletionChunk
+			if err := json.Unmarshal([]byte(event.Data), &chunk); err != nil {
+				return fmt.Errorf("failed to decode chunk: %w", err)
+			}
+			for _, choice := range chunk.Choices {
+				fmt.Print(choice.Delta.Content)
+			}
+		default:
+			fmt.Fprintf(os.Stderr, "\n[%s] %s\n", event.Name, event.Data)
+		}
+	}
+}
@@ -1,82 +1,245 @@
 package config
 
 import (
-	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
+const configFileEnv = "CONFIG_FILE"
+
+var defaultConfigFiles = []string{"bicep-copilot.yaml", "bicep-copilot.yml", "bicep-copilot.json"}
+
 type Config struct {
-	Port string
-	FQDN string
-	ClientID string
-	ClientSecret string
-	Environment string
-	RepoOwner string
-	RepoName string
-	RepoBranch string
-	RepoPath string
-}
-
-const (
-	portEnv         = "PORT"
-	fqdnEnv         = "FQDN"
-	clientIDEnv     = "CLIENT_ID"
-	clientSecretEnv = "CLIENT_SECRET"
-	environmentEnv  = "ENVIRONMENT"
-	repoOwnerEnv    = "REPO_OWNER"
-	repoNameEnv     = "REPO_NAME"
-	repoBranchEnv   = "REPO_BRANCH"
-	repoPathEnv     = "REPO_PATH"
-)
+	Server      ServerConfig      `yaml:"server"`
+	OAuth       OAuthConfig       `yaml:"oauth"`
+	Retrieval   RetrievalConfig   `yaml:"retrieval"`
+	Model       ModelConfig       `yaml:"model" reload:"hot"`
+	ChatBackend ChatBackendConfig `yaml:"chat_backend"`
+	Copilot     CopilotConfig     `yaml:"copilot"`
+	Signature   SignatureConfig   `yaml:"signature"`
+	Access      AccessConfig      `yaml:"access"`
+	RateLimit   RateLimitConfig   `yaml:"rate_limit" reload:"hot"`
+	AnswerCache AnswerCacheConfig `yaml:"answer_cache"`
+	Usage       UsageConfig       `yaml:"usage"`
+	Audit       AuditConfig       `yaml:"audit"`
+
+	file    string
+	sources map[string]Source
+}
+
+type ServerConfig struct {
+	Port         string `yaml:"port" env:"PORT" default:"8080"`
+	FQDN         string `yaml:"fqdn" env:"FQDN"`
+	Environment  string `yaml:"environment" env:"ENVIRONMENT" default:"production"`
+	MaxBodyBytes int64  `yaml:"max_body_bytes" env:"MAX_BODY_BYTES" default:"4194304"`
+	AdminToken   string `yaml:"admin_token" env:"ADMIN_TOKEN" secret:"true"`
+}
+
+type OAuthConfig struct {
+	ClientID           string        `yaml:"client_id" env:"CLIENT_ID"`
+	ClientSecret       string        `yaml:"client_secret" env:"CLIENT_SECRET" secret:"true"`
+	StateDir           string        `yaml:"state_dir" env:"OAUTH_STATE_DIR"`
+	StateTTL           time.Duration `yaml:"state_ttl" env:"OAUTH_STATE_TTL" default:"10m"`
+	TokenStorePath     string        `yaml:"token_store_path" env:"TOKEN_STORE_PATH"`
+	TokenEncryptionKey string        `yaml:"token_encryption_key" env:"TOKEN_ENCRYPTION_KEY" secret:"true"`
+}
+
+type RetrievalConfig struct {
+	RepoOwner  string `yaml:"repo_owner" env:"REPO_OWNER"`
+	RepoName   string `yaml:"repo_name" env:"REPO_NAME"`
+	RepoBranch string `yaml:"repo_branch" env:"REPO_BRANCH" default:"main"`
+	RepoPath   string `yaml:"repo_path" env:"REPO_PATH"`
+	CorpusName string `yaml:"corpus_name" env:"CORPUS_NAME" reload:"hot"`
+	TopK       int    `yaml:"top_k" env:"RETRIEVAL_TOP_K" default:"3" reload:"hot"`
+	OpenAIKey  string `yaml:"openai_api_key" env:"OPENAI_API_KEY" secret:"true"`
+}
+
+type ModelConfig struct {
+	Name            string              `yaml:"name" env:"MODEL"`
+	Fallbacks       []string            `yaml:"fallbacks" env:"MODEL_FALLBACKS"`
+	PromptsDir      string              `yaml:"prompts_dir" env:"PROMPTS_DIR"`
+	Sampling        Sampling            `yaml:"sampling"`
+	CommandSampling map[string]Sampling `yaml:"command_sampling" env:"COMMAND_SAMPLING"`
+}
+
+type Sampling struct {
+	Temperature *float64 `json:"temperature,omitempty" yaml:"temperature" env:"COMPLETION_TEMPERATURE"`
+	TopP        *float64 `json:"top_p,omitempty" yaml:"top_p" env:"COMPLETION_TOP_P"`
+	MaxTokens   *int     `json:"max_tokens,omitempty" yaml:"max_tokens" env:"COMPLETION_MAX_TOKENS"`
+	Stop        []string `json:"stop,omitempty" yaml:"stop" env:"COMPLETION_STOP"`
+	Seed        *int     `json:"seed,omitempty" yaml:"seed" env:"COMPLETION_SEED"`
+	N           *int     `json:"n,omitempty" yaml:"n" env:"COMPLETION_N"`
+}
+
+type ChatBackendConfig struct {
+	Kind             string            `yaml:"kind" env:"CHAT_BACKEND" default:"copilot"`
+	BaseURL          string            `yaml:"base_url" env:"CHAT_BACKEND_BASE_URL"`
+	APIKey           string            `yaml:"api_key" env:"CHAT_BACKEND_API_KEY" secret:"true"`
+	AzureAPIVersion  string            `yaml:"azure_api_version" env:"AZURE_OPENAI_API_VERSION"`
+	AzureDeployments map[string]string `yaml:"azure_deployments" env:"AZURE_OPENAI_DEPLOYMENTS"`
+}
+
+type CopilotConfig struct {
+	BaseURL          string        `yaml:"base_url" env:"COPILOT_BASE_URL"`
+	ConnectTimeout   time.Duration `yaml:"connect_timeout" env:"COPILOT_CONNECT_TIMEOUT" default:"10s"`
+	FirstByteTimeout time.Duration `yaml:"first_byte_timeout" env:"COPILOT_FIRST_BYTE_TIMEOUT" default:"60s"`
+	MaxRetries       int           `yaml:"max_retries" env:"COPILOT_MAX_RETRIES" default:"2"`
+}
+
+type SignatureConfig struct {
+	PublicKeysURL      string        `yaml:"public_keys_url" env:"PUBLIC_KEYS_URL"`
+	RefreshInterval    time.Duration `yaml:"refresh_interval" env:"PUBLIC_KEYS_REFRESH_INTERVAL" default:"1h"`
+	MinRefreshInterval time.Duration `yaml:"min_refresh_interval" env:"PUBLIC_KEYS_MIN_REFRESH_INTERVAL" default:"1m"`
+	DevSigningKeyPath  string        `yaml:"dev_signing_key_path" env:"DEV_SIGNING_KEY_PATH"`
+}
+
+type AccessConfig struct {
+	GitHubAPIURL     string        `yaml:"github_api_url" env:"GITHUB_API_URL"`
+	IdentityCacheTTL time.Duration `yaml:"identity_cache_ttl" env:"IDENTITY_CACHE_TTL" default:"10m"`
+	AllowedOrgs      []string      `yaml:"allowed_orgs" env:"ALLOWED_ORGS" reload:"hot"`
+	AllowedTeams     []string      `yaml:"allowed_teams" env:"ALLOWED_TEAMS" reload:"hot"`
+	AllowedUsers     []string      `yaml:"allowed_users" env:"ALLOWED_USERS" reload:"hot"`
+}
+
+type RateLimitConfig struct {
+	RequestsPerMinute float64       `yaml:"requests_per_minute" env:"RATE_LIMIT_PER_MINUTE" default:"20"`
+	Burst             int           `yaml:"burst" env:"RATE_LIMIT_BURST" default:"5"`
+	MaxConcurrent     int           `yaml:"max_concurrent" env:"MAX_CONCURRENT_COMPLETIONS" default:"16"`
+	ConcurrencyWait   time.Duration `yaml:"concurrency_wait" env:"CONCURRENCY_WAIT" default:"2s"`
+}
+
+type AnswerCacheConfig struct {
+	TTL        time.Duration `yaml:"ttl" env:"ANSWER_CACHE_TTL" default:"0s"`
+	Threshold  float64       `yaml:"threshold" env:"ANSWER_CACHE_THRESHOLD" default:"0.95"`
+	MaxEntries int           `yaml:"max_entries" env:"ANSWER_CACHE_MAX_ENTRIES" default:"500"`
+}
+
+type UsageConfig struct {
+	LogPath string `yaml:"log_path" env:"USAGE_LOG_PATH"`
+}
+
+type AuditConfig struct {
+	LogPath   string        `yaml:"log_path" env:"AUDIT_LOG_PATH"`
+	MaxBytes  int64         `yaml:"max_bytes" env:"AUDIT_MAX_BYTES" default:"10485760"`
+	Retention time.Duration `yaml:"retention" env:"AUDIT_RETENTION" default:"720h"`
+	UserSalt  string        `yaml:"user_salt" env:"AUDIT_USER_SALT" secret:"true"`
+}
 
 func New() (*Config, error) {
+	cfg, err := Resolve()
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func Resolve() (*Config, error) {
 	if err := loadEnv(); err != nil {
 		return nil, fmt.Errorf("failed to load .env file: %w", err)
 	}
 
-	requiredVars := map[string]string{
-		portEnv:         os.Getenv(portEnv),
-		fqdnEnv:         os.Getenv(fqdnEnv),
-		clientIDEnv:     os.Getenv(clientIDEnv),
-		clientSecretEnv: os.Getenv(clientSecretEnv),
-		repoOwnerEnv:    os.Getenv(repoOwnerEnv),
-		repoNameEnv:     os.Getenv(repoNameEnv),
-		repoBranchEnv:   os.Getenv(repoBranchEnv),
-		repoPathEnv:     os.Getenv(repoPathEnv),
+	path, err := findConfigFile()
+	if err != nil {
+		return nil, err
 	}
+	return load(path)
+}
+
+func Load(path string) (*Config, error) {
+	cfg, err := load(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
 
-	var missingVars []string
-	for envVar, value := range requiredVars {
-		if value == "" {
-			missingVars = append(missingVars, envVar)
+func load(path string) (*Config, error) {
+	cfg := &Config{file: path, sources: make(map[string]Source)}
+	if err := applyDefaults(cfg); err != nil {
+		return nil, err
+	}
+
+	if path != "" {
+		if err := loadFile(cfg, path); err != nil {
+			return nil, err
 		}
 	}
 
-	if len(missingVars) > 0 {
-		return nil, fmt.Errorf("missing required environment variables: %s", strings.Join(missingVars, ", "))
+	if err := applyEnv(cfg); err != nil {
+		return nil, err
+	}
+
+	cfg.derive()
+	return cfg, nil
+}
+
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
 	}
+	for _, f := range fields(cfg) {
+		if hasPath(raw, f.Path) {
+			cfg.sources[f.Path] = SourceFile
+		}
+	}
+	return nil
+}
 
-	fqdn := strings.TrimSuffix(requiredVars[fqdnEnv], "/")
+func findConfigFile() (string, error) {
+	if path := os.Getenv(configFileEnv); path != "" {
+		if _, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("config file from %s: %w", configFileEnv, err)
+		}
+		return path, nil
+	}
 
-	env := os.Getenv(environmentEnv)
-	if env == "" {
-		env = "production"
+	for _, name := range defaultConfigFiles {
+		if _, err := os.Stat(name); err == nil {
+			return name, nil
+		}
 	}
+	return "", nil
+}
+
+func (c *Config) derive() {
+	c.Server.FQDN = strings.TrimSuffix(c.Server.FQDN, "/")
+	c.Server.Environment = strings.ToLower(c.Server.Environment)
+	c.ChatBackend.Kind = strings.ToLower(c.ChatBackend.Kind)
 
-	return &Config{
-		Port:         requiredVars[portEnv],
-		FQDN:         fqdn,
-		ClientID:     requiredVars[clientIDEnv],
-		ClientSecret: requiredVars[clientSecretEnv],
-		Environment:  env,
-		RepoOwner:    requiredVars[repoOwnerEnv],
-		RepoName:     requiredVars[repoNameEnv],
-		RepoBranch:   requiredVars[repoBranchEnv],
-		RepoPath:     requiredVars[repoPathEnv],
-	}, nil
+	if c.Retrieval.CorpusName == "" && c.Retrieval.RepoOwner != "" && c.Retrieval.RepoName != "" {
+		c.Retrieval.CorpusName = c.Retrieval.RepoOwner + "/" + c.Retrieval.RepoName
+		c.sources["retrieval.corpus_name"] = SourceDerived
+	}
+	if c.ChatBackend.Kind == "openai" && c.ChatBackend.APIKey == "" && c.Retrieval.OpenAIKey != "" {
+		c.ChatBackend.APIKey = c.Retrieval.OpenAIKey
+		c.sources["chat_backend.api_key"] = SourceDerived
+	}
 }
 
 func loadEnv() error {
@@ -89,42 +252,22 @@ func loadEnv() error {
 		return nil
 	}
 
-	file, err := os.Open(envPath)
+	data, err := os.ReadFile(envPath)
 	if err != nil {
-		return fmt.Errorf("error opening .env file: %w", err)
+		return fmt.Errorf("error reading .env file: %w", err)
 	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	lineNum := 0
-
-	for scanner.Scan() {
-		lineNum++
-		line := strings.TrimSpace(scanner.Text())
 
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) != 2 {
-			return fmt.Errorf("invalid format in .env file line %d: %s", lineNum, line)
-		}
-
-		key := strings.TrimSpace(parts[0])
-		value := strings.TrimSpace(parts[1])
-
-		value = strings.Trim(value, `"'`)
+	values, err := parseDotenv(string(data), os.LookupEnv)
+	if err != nil {
+		return fmt.Errorf("invalid .env file %s: %w", envPath, err)
+	}
 
+	for key, value := range values {
 		if os.Getenv(key) == "" {
 			os.Setenv(key, value)
+			dotenvVars[key] = true
 		}
 	}
-
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("error reading .env file: %w", err)
-	}
-
 	return nil
 }
 
@@ -148,10 +291,24 @@ func findEnvFile() (string, error) {
 	}
 }
 
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (c *Config) File() string {
+	return c.file
+}
+
 func (c *Config) IsDevelopment() bool {
-	return strings.ToLower(c.Environment) == "development"
+	return strings.ToLower(c.Server.Environment) == "development"
 }
 
 func (c *Config) IsProduction() bool {
-	return strings.ToLower(c.Environment) == "production"
-}
\ No newline at end of file
+	return strings.ToLower(c.Server.Environment) == "production"
+}
@@ -3,7 +3,9 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNew(t *testing.T) {
@@ -17,6 +19,7 @@ func TestNew(t *testing.T) {
 		"REPO_BRANCH":   "main",
 		"REPO_PATH":     "docs",
 		"ENVIRONMENT":   "production",
+		"OPENAI_API_KEY": "test-key",
 	}
 
 	for k, v := range envVars {
@@ -29,12 +32,12 @@ func TestNew(t *testing.T) {
 		t.Fatalf("New() error = %v", err)
 	}
 
-	if cfg.Port != "8080" {
-		t.Errorf("New() Port = %v, want 8080", cfg.Port)
+	if cfg.Server.Port != "8080" {
+		t.Errorf("New() Port = %v, want 8080", cfg.Server.Port)
 	}
 
-	if cfg.FQDN != "https://example.com" {
-		t.Errorf("New() FQDN = %v, want https://example.com", cfg.FQDN)
+	if cfg.Server.FQDN != "https://example.com" {
+		t.Errorf("New() FQDN = %v, want https://example.com", cfg.Server.FQDN)
 	}
 
 	if !cfg.IsProduction() {
@@ -42,6 +45,46 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestNewSampling(t *testing.T) {
+	envVars := map[string]string{
+		"PORT":                   "8080",
+		"FQDN":                   "https://example.com",
+		"CLIENT_ID":              "test-client",
+		"CLIENT_SECRET":          "test-secret",
+		"REPO_OWNER":             "owner",
+		"REPO_NAME":              "repo",
+		"REPO_BRANCH":            "main",
+		"REPO_PATH":              "docs",
+		"COMPLETION_TEMPERATURE": "0.3",
+		"COMPLETION_STOP":        "END, STOP",
+		"COMMAND_SAMPLING":       `{"lookup":{"temperature":0,"max_tokens":400}}`,
+		"OPENAI_API_KEY":         "test-key",
+	}
+
+	for k, v := range envVars {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+
+	cfg, err := New()
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if cfg.Model.Sampling.Temperature == nil || *cfg.Model.Sampling.Temperature != 0.3 {
+		t.Errorf("New() Sampling.Temperature = %v, want 0.3", cfg.Model.Sampling.Temperature)
+	}
+
+	if len(cfg.Model.Sampling.Stop) != 2 || cfg.Model.Sampling.Stop[1] != "STOP" {
+		t.Errorf("New() Sampling.Stop = %v, want [END STOP]", cfg.Model.Sampling.Stop)
+	}
+
+	lookup, ok := cfg.Model.CommandSampling["lookup"]
+	if !ok || lookup.Temperature == nil || *lookup.Temperature != 0 || *lookup.MaxTokens != 400 {
+		t.Errorf("New() CommandSampling[lookup] = %+v", lookup)
+	}
+}
+
 func TestLoadEnv(t *testing.T) {
 	tmpDir := t.TempDir()
 	envContent := `
@@ -67,3 +110,144 @@ CLIENT_SECRET=local-secret
 		t.Errorf("loadEnv() PORT = %v, want 9090", os.Getenv("PORT"))
 	}
 }
+
+func clearConfigEnv(t *testing.T) {
+	t.Helper()
+	for _, f := range fields(&Config{}) {
+		if f.Env != "" {
+			t.Setenv(f.Env, "")
+		}
+	}
+	t.Setenv("OPENAI_API_KEY", "test-key")
+}
+
+func TestLoadFileWithEnvOverrides(t *testing.T) {
+	clearConfigEnv(t)
+	path := filepath.Join(t.TempDir(), "bicep-copilot.yaml")
+	content := `
+server:
+  environment: development
+  port: "9000"
+retrieval:
+  repo_owner: Azure
+  repo_name: bicep-types-az
+model:
+  name: gpt-4o
+  fallbacks: [gpt-4o-mini]
+  sampling:
+    temperature: 0.2
+  command_sampling:
+    lookup:
+      max_tokens: 400
+rate_limit:
+  requests_per_minute: 60
+answer_cache:
+  ttl: 15m
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	t.Setenv("RATE_LIMIT_BURST", "9")
+	t.Setenv("MODEL", "gpt-4.1")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if cfg.Server.Port != "9000" || !cfg.IsDevelopment() {
+		t.Errorf("Load() Server = %+v", cfg.Server)
+	}
+	if cfg.Retrieval.CorpusName != "Azure/bicep-types-az" || cfg.Retrieval.RepoBranch != "main" {
+		t.Errorf("Load() Retrieval = %+v", cfg.Retrieval)
+	}
+	if cfg.Model.Name != "gpt-4.1" {
+		t.Errorf("Load() Model.Name = %q, want env override gpt-4.1", cfg.Model.Name)
+	}
+	if len(cfg.Model.Fallbacks) != 1 || *cfg.Model.Sampling.Temperature != 0.2 || *cfg.Model.CommandSampling["lookup"].MaxTokens != 400 {
+		t.Errorf("Load() Model = %+v", cfg.Model)
+	}
+	if cfg.RateLimit.RequestsPerMinute != 60 || cfg.RateLimit.Burst != 9 || cfg.RateLimit.MaxConcurrent != 16 {
+		t.Errorf("Load() RateLimit = %+v", cfg.RateLimit)
+	}
+	if cfg.AnswerCache.TTL != 15*time.Minute || cfg.AnswerCache.Threshold != 0.95 {
+		t.Errorf("Load() AnswerCache = %+v", cfg.AnswerCache)
+	}
+}
+
+func TestLoadJSONFile(t *testing.T) {
+	clearConfigEnv(t)
+	path := filepath.Join(t.TempDir(), "bicep-copilot.json")
+	content := `{"server": {"environment": "development"}, "retrieval": {"repo_owner": "Azure", "repo_name": "bicep"}, "copilot": {"connect_timeout": "3s"}}`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Copilot.ConnectTimeout != 3*time.Second {
+		t.Errorf("Load() Copilot.ConnectTimeout = %v, want 3s", cfg.Copilot.ConnectTimeout)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		env     map[string]string
+		want    []string
+	}{
+		{
+			name:    "unknown key",
+			content: "server:\n  prot: 8080\n",
+			want:    []string{"line 2", "prot"},
+		},
+		{
+			name:    "wrong type",
+			content: "rate_limit:\n  burst: lots\n",
+			want:    []string{"line 2", "lots"},
+		},
+		{
+			name:    "validation",
+			content: "server:\n  port: \"0\"\nmodel:\n  sampling:\n    temperature: 3\nchat_backend:\n  kind: bard\n",
+			want: []string{
+				`server.port (PORT): must be a port number between 1 and 65535, got "0"`,
+				"server.fqdn (FQDN): is required",
+				"retrieval.repo_owner (REPO_OWNER): is required",
+				"model.sampling.temperature (COMPLETION_TEMPERATURE): must be between 0 and 2, got 3",
+				`chat_backend.kind (CHAT_BACKEND): must be one of copilot, openai, azure, compatible, got "bard"`,
+			},
+		},
+		{
+			name:    "bad env override",
+			content: "retrieval:\n  repo_owner: a\n  repo_name: b\n",
+			env:     map[string]string{"COPILOT_CONNECT_TIMEOUT": "soon"},
+			want:    []string{"COPILOT_CONNECT_TIMEOUT (copilot.connect_timeout)", `expected a duration like 30s or 5m, got "soon"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearConfigEnv(t)
+			path := filepath.Join(t.TempDir(), "bicep-copilot.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("WriteFile() error = %v", err)
+			}
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			_, err := Load(path)
+			if err == nil {
+				t.Fatal("Load() error = nil, want error")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Load() error = %v\nwant it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
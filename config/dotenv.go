@@ -0,0 +1,270 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var dotenvKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+type dotenvParser struct {
+	src    string
+	pos    int
+	line   int
+	values map[string]string
+	lookup func(string) (string, bool)
+}
+
+func parseDotenv(src string, lookup func(string) (string, bool)) (map[string]string, error) {
+	p := &dotenvParser{
+		src:    strings.ReplaceAll(src, "\r\n", "\n"),
+		line:   1,
+		values: make(map[string]string),
+		lookup: lookup,
+	}
+
+	for {
+		p.skipBlank()
+		if p.pos >= len(p.src) {
+			return p.values, nil
+		}
+		if err := p.parseEntry(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *dotenvParser) errorf(line int, format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+func (p *dotenvParser) skipBlank() {
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case ' ', '\t', '\r':
+			p.pos++
+		case '\n':
+			p.pos++
+			p.line++
+		case '#':
+			p.skipLine()
+		default:
+			return
+		}
+	}
+}
+
+func (p *dotenvParser) skipSpaces() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *dotenvParser) skipLine() {
+	if i := strings.IndexByte(p.src[p.pos:], '\n'); i >= 0 {
+		p.pos += i
+	} else {
+		p.pos = len(p.src)
+	}
+}
+
+func (p *dotenvParser) readKey() string {
+	start := p.pos
+	for p.pos < len(p.src) && !strings.ContainsRune(" \t\r\n=", rune(p.src[p.pos])) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *dotenvParser) parseEntry() error {
+	line := p.line
+	key := p.readKey()
+	if key == "export" {
+		p.skipSpaces()
+		if p.pos < len(p.src) && p.src[p.pos] != '=' {
+			key = p.readKey()
+		}
+	}
+	if !dotenvKeyPattern.MatchString(key) {
+		return p.errorf(line, "invalid variable name %q", key)
+	}
+
+	p.skipSpaces()
+	if p.pos >= len(p.src) || p.src[p.pos] != '=' {
+		return p.errorf(line, "expected %s=VALUE", key)
+	}
+	p.pos++
+	p.skipSpaces()
+
+	var value string
+	var err error
+	switch {
+	case p.pos < len(p.src) && p.src[p.pos] == '"':
+		value, err = p.doubleQuoted(line)
+	case p.pos < len(p.src) && p.src[p.pos] == '\'':
+		value, err = p.singleQuoted(line)
+	default:
+		value, err = p.unquoted(line)
+	}
+	if err != nil {
+		return err
+	}
+
+	p.skipSpaces()
+	if p.pos < len(p.src) && p.src[p.pos] == '#' {
+		p.skipLine()
+	}
+	if p.pos < len(p.src) && p.src[p.pos] != '\n' && p.src[p.pos] != '\r' {
+		return p.errorf(p.line, "unexpected %q after the value of %s", p.src[p.pos], key)
+	}
+
+	p.values[key] = value
+	return nil
+}
+
+func (p *dotenvParser) unquoted(line int) (string, error) {
+	start := p.pos
+	p.skipLine()
+	raw := p.src[start:p.pos]
+
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '#' && (i == 0 || raw[i-1] == ' ' || raw[i-1] == '\t') {
+			raw = raw[:i]
+			break
+		}
+	}
+	raw = strings.TrimSpace(raw)
+
+	var b strings.Builder
+	for i := 0; i < len(raw); {
+		if raw[i] != '$' {
+			b.WriteByte(raw[i])
+			i++
+			continue
+		}
+		value, next, err := p.variable(raw, i, line)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(value)
+		i = next
+	}
+	return b.String(), nil
+}
+
+func (p *dotenvParser) singleQuoted(line int) (string, error) {
+	end := strings.IndexByte(p.src[p.pos+1:], '\'')
+	if end < 0 {
+		return "", p.errorf(line, "unterminated single-quoted value")
+	}
+
+	value := p.src[p.pos+1 : p.pos+1+end]
+	p.line += strings.Count(value, "\n")
+	p.pos += end + 2
+	return value, nil
+}
+
+func (p *dotenvParser) doubleQuoted(line int) (string, error) {
+	var b strings.Builder
+	p.pos++
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch c {
+		case '"':
+			p.pos++
+			return b.String(), nil
+		case '\\':
+			if p.pos+1 >= len(p.src) {
+				return "", p.errorf(line, "unterminated double-quoted value")
+			}
+			p.pos += 2
+			switch escaped := p.src[p.pos-1]; escaped {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case '"', '\\', '$':
+				b.WriteByte(escaped)
+			case '\n':
+				p.line++
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(escaped)
+			}
+		case '$':
+			value, next, err := p.variable(p.src, p.pos, p.line)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(value)
+			p.pos = next
+		default:
+			if c == '\n' {
+				p.line++
+			}
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+	return "", p.errorf(line, "unterminated double-quoted value")
+}
+
+func (p *dotenvParser) variable(s string, i, line int) (string, int, error) {
+	if i+1 < len(s) && s[i+1] == '{' {
+		end := strings.IndexAny(s[i+2:], "}\n")
+		if end < 0 || s[i+2+end] != '}' {
+			return "", 0, p.errorf(line, "unterminated ${ in value")
+		}
+
+		name, fallback, hasFallback := strings.Cut(s[i+2:i+2+end], ":-")
+		if !isVariableName(name) {
+			return "", 0, p.errorf(line, "invalid variable reference ${%s}", s[i+2:i+2+end])
+		}
+		value := p.resolve(name)
+		if value == "" && hasFallback {
+			value = fallback
+		}
+		return value, i + 3 + end, nil
+	}
+
+	end := i + 1
+	for end < len(s) && isNameByte(s[end], end == i+1) {
+		end++
+	}
+	if end == i+1 {
+		return "$", end, nil
+	}
+	return p.resolve(s[i+1 : end]), end, nil
+}
+
+func (p *dotenvParser) resolve(name string) string {
+	if value, ok := p.lookup(name); ok && value != "" {
+		return value
+	}
+	return p.values[name]
+}
+
+func isVariableName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isNameByte(name[i], i == 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func isNameByte(c byte, first bool) bool {
+	switch {
+	case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		return true
+	case c >= '0' && c <= '9':
+		return !first
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+type field struct {
+	Path    string
+	Env     string
+	Default string
+	Hot     bool
+	Secret  bool
+	Value   reflect.Value
+}
+
+func fields(cfg *Config) []field {
+	var result []field
+	collectFields(reflect.ValueOf(cfg).Elem(), "", false, &result)
+	return result
+}
+
+func collectFields(v reflect.Value, prefix string, hot bool, result *[]field) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		structField := t.Field(i)
+		name, _, _ := strings.Cut(structField.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+
+		value := v.Field(i)
+		env := structField.Tag.Get("env")
+		fieldHot := hot || structField.Tag.Get("reload") == "hot"
+		if env == "" && value.Kind() == reflect.Struct {
+			collectFields(value, path, fieldHot, result)
+			continue
+		}
+
+		*result = append(*result, field{
+			Path:    path,
+			Env:     env,
+			Default: structField.Tag.Get("default"),
+			Hot:     fieldHot,
+			Secret:  structField.Tag.Get("secret") == "true",
+			Value:   value,
+		})
+	}
+}
+
+func applyDefaults(cfg *Config) error {
+	for _, f := range fields(cfg) {
+		if f.Default == "" {
+			continue
+		}
+		if err := setValue(f.Value, f.Default); err != nil {
+			return fmt.Errorf("invalid default for %s: %w", f.Path, err)
+		}
+		cfg.sources[f.Path] = SourceDefault
+	}
+	return nil
+}
+
+func applyEnv(cfg *Config) error {
+	for _, f := range fields(cfg) {
+		if f.Env == "" {
+			continue
+		}
+		raw := os.Getenv(f.Env)
+		if raw == "" {
+			continue
+		}
+		if err := setValue(f.Value, raw); err != nil {
+			return fmt.Errorf("invalid value for %s (%s): %w", f.Env, f.Path, err)
+		}
+		cfg.sources[f.Path] = SourceEnv
+		if dotenvVars[f.Env] {
+			cfg.sources[f.Path] = SourceDotenv
+		}
+	}
+	return nil
+}
+
+func setValue(v reflect.Value, raw string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("expected a duration like 30s or 5m, got %q", raw)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		elem := reflect.New(v.Type().Elem())
+		if err := setValue(elem.Elem(), raw); err != nil {
+			return err
+		}
+		v.Set(elem)
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+		if err != nil {
+			return fmt.Errorf("expected an integer, got %q", raw)
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil {
+			return fmt.Errorf("expected a number, got %q", raw)
+		}
+		v.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("expected true or false, got %q", raw)
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported list type %s", v.Type())
+		}
+		v.Set(reflect.ValueOf(splitList(raw)))
+	case reflect.Map:
+		if v.Type().Elem().Kind() == reflect.String {
+			m, err := parseMap(raw)
+			if err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(m))
+			return nil
+		}
+		target := reflect.New(v.Type())
+		if err := json.Unmarshal([]byte(raw), target.Interface()); err != nil {
+			return fmt.Errorf("invalid JSON: %w", err)
+		}
+		v.Set(target.Elem())
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+func parseMap(raw string) (map[string]string, error) {
+	items := splitList(raw)
+	if len(items) == 0 {
+		return nil, nil
+	}
+
+	result := make(map[string]string, len(items))
+	for _, item := range items {
+		k, v, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(k) == "" || strings.TrimSpace(v) == "" {
+			return nil, fmt.Errorf("invalid entry %q, expected key=value", item)
+		}
+		result[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return result, nil
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const pollInterval = 5 * time.Second
+
+type ApplyFunc func(next *Config) error
+
+func Changes(current, next *Config) (hot, restart []string) {
+	nextFields := fields(next)
+	for i, f := range fields(current) {
+		if reflect.DeepEqual(f.Value.Interface(), nextFields[i].Value.Interface()) {
+			continue
+		}
+		if f.Hot {
+			hot = append(hot, f.Path)
+		} else {
+			restart = append(restart, f.Path)
+		}
+	}
+	return hot, restart
+}
+
+func Watch(ctx context.Context, current *Config, apply ApplyFunc) {
+	r := &reloader{current: current, apply: apply}
+	r.stamp = r.watchedStamp()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(signals)
+
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-signals:
+				r.reload("SIGHUP")
+			case <-ticker.C:
+				if r.filesChanged() {
+					r.reload("file change")
+				}
+			}
+		}
+	}()
+}
+
+type reloader struct {
+	current *Config
+	apply   ApplyFunc
+	stamp   string
+}
+
+// watchedStamp summarizes the modification times of the config file and the
+// prompt templates, so editing, adding or removing any of them is noticed.
+func (r *reloader) watchedStamp() string {
+	paths := []string{r.current.file}
+	if dir := r.current.Model.PromptsDir; dir != "" {
+		templates, _ := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+		paths = append(paths, templates...)
+	}
+
+	var b strings.Builder
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			fmt.Fprintf(&b, "%s:%d;", path, info.ModTime().UnixNano())
+		}
+	}
+	return b.String()
+}
+
+func (r *reloader) filesChanged() bool {
+	stamp := r.watchedStamp()
+	if stamp == r.stamp {
+		return false
+	}
+	r.stamp = stamp
+	return true
+}
+
+func (r *reloader) reload(reason string) bool {
+	next, err := Load(r.current.file)
+	if err != nil {
+		log.Printf("Config reload (%s) rejected, keeping current settings: %v", reason, err)
+		return false
+	}
+
+	_, restart := Changes(r.current, next)
+	if len(restart) > 0 {
+		log.Printf("Config reload (%s): %s changed but require a restart to take effect", reason, strings.Join(restart, ", "))
+	}
+
+	// Derived hot values are recomputed from the merged config rather than
+	// copied, since their inputs may be restart-only settings that changed.
+	merged := *r.current
+	merged.sources = make(map[string]Source, len(r.current.sources))
+	nextFields := fields(next)
+	for i, f := range fields(&merged) {
+		source, ok := r.current.sources[f.Path]
+		if f.Hot {
+			source, ok = next.sources[f.Path]
+			if source == SourceDerived {
+				f.Value.Set(reflect.Zero(f.Value.Type()))
+				ok = false
+			} else {
+				f.Value.Set(nextFields[i].Value)
+			}
+		}
+		if ok {
+			merged.sources[f.Path] = source
+		}
+	}
+	merged.derive()
+	hot, _ := Changes(r.current, &merged)
+
+	if err := r.apply(&merged); err != nil {
+		log.Printf("Config reload (%s) failed, keeping current settings: %v", reason, err)
+		return false
+	}
+
+	r.current = &merged
+	r.stamp = r.watchedStamp()
+	if len(hot) == 0 {
+		log.Printf("Config reload (%s): settings unchanged, reapplied current settings and prompt templates", reason)
+	} else {
+		log.Printf("Config reload (%s): applied %s", reason, strings.Join(hot, ", "))
+	}
+	return true
+}
@@ -0,0 +1,193 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const reloadBaseConfig = `
+server:
+  environment: development
+retrieval:
+  repo_owner: Azure
+  repo_name: bicep-types-az
+model:
+  name: gpt-4o
+`
+
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	clearConfigEnv(t)
+	path := filepath.Join(t.TempDir(), "bicep-copilot.yaml")
+	writeConfig(t, path, reloadBaseConfig)
+	current, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	writeConfig(t, path, `
+server:
+  environment: development
+  port: "9000"
+retrieval:
+  repo_owner: Azure
+  repo_name: bicep-types-az
+model:
+  name: gpt-4o
+  fallbacks: [gpt-4o-mini]
+access:
+  allowed_users: [octocat]
+`)
+	next, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	hot, restart := Changes(current, next)
+	if want := []string{"model.fallbacks", "access.allowed_users"}; !reflect.DeepEqual(hot, want) {
+		t.Errorf("Changes() hot = %v, want %v", hot, want)
+	}
+	if want := []string{"server.port"}; !reflect.DeepEqual(restart, want) {
+		t.Errorf("Changes() restart = %v, want %v", restart, want)
+	}
+}
+
+func TestReloaderAppliesOnlyHotSettings(t *testing.T) {
+	clearConfigEnv(t)
+	path := filepath.Join(t.TempDir(), "bicep-copilot.yaml")
+	writeConfig(t, path, reloadBaseConfig)
+	current, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	var applied *Config
+	r := &reloader{current: current, apply: func(next *Config) error {
+		applied = next
+		return nil
+	}}
+
+	writeConfig(t, path, `
+server:
+  environment: development
+  port: "9000"
+retrieval:
+  repo_owner: Azure
+  repo_name: bicep-types-az
+  top_k: 5
+model:
+  name: gpt-4.1
+`)
+	if !r.reload("test") {
+		t.Fatal("reload() = false, want true")
+	}
+	if applied.Model.Name != "gpt-4.1" || applied.Retrieval.TopK != 5 {
+		t.Errorf("reload() applied model=%q top_k=%d, want gpt-4.1 and 5", applied.Model.Name, applied.Retrieval.TopK)
+	}
+	if applied.Server.Port != "8080" {
+		t.Errorf("reload() applied server.port = %q, want restart-only value 8080 kept", applied.Server.Port)
+	}
+	if r.current != applied {
+		t.Error("reload() did not keep the applied config as current")
+	}
+
+	writeConfig(t, path, reloadBaseConfig+`
+rate_limit:
+  burst: -1
+`)
+	if r.reload("test") {
+		t.Error("reload() with invalid config = true, want false")
+	}
+	if r.current != applied {
+		t.Error("reload() with invalid config replaced the current config")
+	}
+}
+
+func TestReloaderKeepsDerivedCorpusUntilRestart(t *testing.T) {
+	clearConfigEnv(t)
+	path := filepath.Join(t.TempDir(), "bicep-copilot.yaml")
+	writeConfig(t, path, reloadBaseConfig)
+	current, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	var applied *Config
+	r := &reloader{current: current, apply: func(next *Config) error {
+		applied = next
+		return nil
+	}}
+
+	writeConfig(t, path, strings.Replace(reloadBaseConfig, "repo_owner: Azure", "repo_owner: Contoso", 1))
+	if !r.reload("test") {
+		t.Fatal("reload() = false, want true")
+	}
+	if got := applied.Retrieval.CorpusName; got != "Azure/bicep-types-az" {
+		t.Errorf("reload() applied corpus_name = %q, want the name derived from the running repository", got)
+	}
+
+	writeConfig(t, path, strings.Replace(reloadBaseConfig, "retrieval:\n", "retrieval:\n  corpus_name: Contoso/modules\n", 1))
+	if !r.reload("test") {
+		t.Fatal("reload() = false, want true")
+	}
+	if got := applied.Retrieval.CorpusName; got != "Contoso/modules" {
+		t.Errorf("reload() applied corpus_name = %q, want the explicitly set Contoso/modules", got)
+	}
+
+	writeConfig(t, path, reloadBaseConfig)
+	if !r.reload("test") {
+		t.Fatal("reload() = false, want true")
+	}
+	if got := applied.Retrieval.CorpusName; got != "Azure/bicep-types-az" {
+		t.Errorf("reload() after removing corpus_name applied %q, want it derived again", got)
+	}
+}
+
+func TestReloaderWatchesPromptTemplates(t *testing.T) {
+	clearConfigEnv(t)
+	dir := t.TempDir()
+	template := filepath.Join(dir, "system.tmpl")
+	writeConfig(t, template, "v1")
+
+	path := filepath.Join(dir, "bicep-copilot.yaml")
+	writeConfig(t, path, reloadBaseConfig+"  prompts_dir: "+dir+"\n")
+	current, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	applied := 0
+	r := &reloader{current: current, apply: func(next *Config) error {
+		applied++
+		return nil
+	}}
+	r.stamp = r.watchedStamp()
+
+	if r.filesChanged() {
+		t.Error("filesChanged() without edits = true, want false")
+	}
+
+	writeConfig(t, template, "v2")
+	later := time.Now().Add(time.Second)
+	os.Chtimes(template, later, later)
+	if !r.filesChanged() {
+		t.Fatal("filesChanged() after editing a template = false, want true")
+	}
+	if !r.reload("file change") || applied != 1 {
+		t.Errorf("reload() after editing a template applied %d times, want 1", applied)
+	}
+
+	if !r.reload("SIGHUP") || applied != 2 {
+		t.Errorf("reload() on SIGHUP with unchanged config applied %d times, want 2", applied)
+	}
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+type Source string
+
+const (
+	SourceUnset   Source = "unset"
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceDotenv  Source = ".env"
+	SourceEnv     Source = "env"
+	SourceDerived Source = "derived"
+)
+
+const secretMask = "********"
+
+var dotenvVars = make(map[string]bool)
+
+type Setting struct {
+	Path   string
+	Env    string
+	Value  string
+	Source Source
+	Secret bool
+}
+
+func (c *Config) Settings() []Setting {
+	var settings []Setting
+	for _, f := range fields(c) {
+		source, ok := c.sources[f.Path]
+		if !ok {
+			source = SourceUnset
+		}
+
+		value := formatValue(f.Value)
+		if f.Secret && value != "" {
+			value = secretMask
+		}
+
+		settings = append(settings, Setting{
+			Path:   f.Path,
+			Env:    f.Env,
+			Value:  value,
+			Source: source,
+			Secret: f.Secret,
+		})
+	}
+	return settings
+}
+
+func formatValue(v reflect.Value) string {
+	if v.Type() == durationType {
+		return fmt.Sprint(v.Interface())
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return ""
+		}
+		return formatValue(v.Elem())
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = formatValue(v.Index(i))
+		}
+		return strings.Join(items, ",")
+	case reflect.Map:
+		if v.Len() == 0 {
+			return ""
+		}
+		if v.Type().Elem().Kind() == reflect.String {
+			var items []string
+			for _, key := range v.MapKeys() {
+				items = append(items, fmt.Sprintf("%v=%v", key.Interface(), v.MapIndex(key).Interface()))
+			}
+			sort.Strings(items)
+			return strings.Join(items, ",")
+		}
+		data, err := json.Marshal(v.Interface())
+		if err != nil {
+			return fmt.Sprint(v.Interface())
+		}
+		return string(data)
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+func hasPath(raw map[string]interface{}, path string) bool {
+	current := raw
+	parts := strings.Split(path, ".")
+	for i, part := range parts {
+		value, ok := current[part]
+		if !ok {
+			return false
+		}
+		if i == len(parts)-1 {
+			return true
+		}
+		if current, ok = value.(map[string]interface{}); !ok {
+			return false
+		}
+	}
+	return false
+}
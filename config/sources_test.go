@@ -0,0 +1,51 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSettingsSources(t *testing.T) {
+	clearConfigEnv(t)
+	dir := t.TempDir()
+	writeConfig(t, filepath.Join(dir, ".env"), "CLIENT_SECRET=from-dotenv\n")
+	writeConfig(t, filepath.Join(dir, "bicep-copilot.yaml"), reloadBaseConfig)
+	t.Setenv("MODEL", "gpt-4.1")
+	t.Cleanup(func() { dotenvVars = make(map[string]bool) })
+
+	origWd, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(origWd)
+
+	cfg, err := Resolve()
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+
+	settings := make(map[string]Setting)
+	for _, setting := range cfg.Settings() {
+		settings[setting.Path] = setting
+	}
+
+	tests := []struct {
+		path   string
+		value  string
+		source Source
+	}{
+		{path: "server.port", value: "8080", source: SourceDefault},
+		{path: "server.environment", value: "development", source: SourceFile},
+		{path: "model.name", value: "gpt-4.1", source: SourceEnv},
+		{path: "oauth.client_secret", value: secretMask, source: SourceDotenv},
+		{path: "retrieval.openai_api_key", value: secretMask, source: SourceEnv},
+		{path: "retrieval.corpus_name", value: "Azure/bicep-types-az", source: SourceDerived},
+		{path: "oauth.client_id", value: "", source: SourceUnset},
+		{path: "copilot.connect_timeout", value: "10s", source: SourceDefault},
+	}
+	for _, tt := range tests {
+		got := settings[tt.path]
+		if got.Value != tt.value || got.Source != tt.source {
+			t.Errorf("Settings() %s = %q from %s, want %q from %s", tt.path, got.Value, got.Source, tt.value, tt.source)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var (
+	environments = []string{"development", "production"}
+	chatBackends = []string{"copilot", "openai", "azure", "compatible"}
+)
+
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+type validator struct {
+	envs     map[string]string
+	problems []string
+}
+
+func (v *validator) fail(path, format string, args ...interface{}) {
+	name := path
+	if env := v.envs[path]; env != "" {
+		name = fmt.Sprintf("%s (%s)", path, env)
+	}
+	v.problems = append(v.problems, name+": "+fmt.Sprintf(format, args...))
+}
+
+func (v *validator) required(path, value string) {
+	if value == "" {
+		v.fail(path, "is required")
+	}
+}
+
+func (v *validator) oneOf(path, value string, allowed []string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.fail(path, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+}
+
+func (v *validator) url(path, value string) {
+	if value == "" {
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.fail(path, "must be an absolute http(s) URL, got %q", value)
+	}
+}
+
+func (v *validator) nonNegative(path string, value float64) {
+	if value < 0 {
+		v.fail(path, "must not be negative, got %v", value)
+	}
+}
+
+func (v *validator) between(path string, value *float64, min, max float64) {
+	if value != nil && (*value < min || *value > max) {
+		v.fail(path, "must be between %v and %v, got %v", min, max, *value)
+	}
+}
+
+func (c *Config) Validate() error {
+	v := &validator{envs: make(map[string]string)}
+	for _, f := range fields(c) {
+		v.envs[f.Path] = f.Env
+	}
+
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port < 1 || port > 65535 {
+		v.fail("server.port", "must be a port number between 1 and 65535, got %q", c.Server.Port)
+	}
+	v.oneOf("server.environment", c.Server.Environment, environments)
+	v.url("server.fqdn", c.Server.FQDN)
+	if c.Server.MaxBodyBytes <= 0 {
+		v.fail("server.max_body_bytes", "must be positive, got %d", c.Server.MaxBodyBytes)
+	}
+
+	if c.IsProduction() {
+		v.required("server.fqdn", c.Server.FQDN)
+		v.required("oauth.client_id", c.OAuth.ClientID)
+		v.required("oauth.client_secret", c.OAuth.ClientSecret)
+	} else if (c.OAuth.ClientID == "") != (c.OAuth.ClientSecret == "") {
+		v.fail("oauth.client_secret", "must be set together with oauth.client_id")
+	}
+	if c.OAuth.ClientID != "" {
+		v.required("server.fqdn", c.Server.FQDN)
+	}
+	v.nonNegative("oauth.state_ttl", float64(c.OAuth.StateTTL))
+
+	v.required("retrieval.repo_owner", c.Retrieval.RepoOwner)
+	v.required("retrieval.repo_name", c.Retrieval.RepoName)
+	v.required("retrieval.repo_branch", c.Retrieval.RepoBranch)
+	v.required("retrieval.openai_api_key", c.Retrieval.OpenAIKey)
+	if c.Retrieval.TopK < 1 {
+		v.fail("retrieval.top_k", "must be at least 1, got %d", c.Retrieval.TopK)
+	}
+
+	v.between("model.sampling.temperature", c.Model.Sampling.Temperature, 0, 2)
+	v.between("model.sampling.top_p", c.Model.Sampling.TopP, 0, 1)
+	for command, sampling := range c.Model.CommandSampling {
+		prefix := "model.command_sampling." + command
+		v.between(prefix+".temperature", sampling.Temperature, 0, 2)
+		v.between(prefix+".top_p", sampling.TopP, 0, 1)
+	}
+
+	v.oneOf("chat_backend.kind", c.ChatBackend.Kind, chatBackends)
+	v.url("chat_backend.base_url", c.ChatBackend.BaseURL)
+	switch c.ChatBackend.Kind {
+	case "azure":
+		v.required("chat_backend.base_url", c.ChatBackend.BaseURL)
+		v.required("chat_backend.api_key", c.ChatBackend.APIKey)
+	case "compatible":
+		v.required("chat_backend.base_url", c.ChatBackend.BaseURL)
+	}
+
+	v.url("copilot.base_url", c.Copilot.BaseURL)
+	v.nonNegative("copilot.connect_timeout", float64(c.Copilot.ConnectTimeout))
+	v.nonNegative("copilot.first_byte_timeout", float64(c.Copilot.FirstByteTimeout))
+	v.nonNegative("copilot.max_retries", float64(c.Copilot.MaxRetries))
+
+	v.url("signature.public_keys_url", c.Signature.PublicKeysURL)
+	v.nonNegative("signature.refresh_interval", float64(c.Signature.RefreshInterval))
+	v.nonNegative("signature.min_refresh_interval", float64(c.Signature.MinRefreshInterval))
+
+	v.url("access.github_api_url", c.Access.GitHubAPIURL)
+	v.nonNegative("access.identity_cache_ttl", float64(c.Access.IdentityCacheTTL))
+
+	v.nonNegative("rate_limit.requests_per_minute", c.RateLimit.RequestsPerMinute)
+	v.nonNegative("rate_limit.burst", float64(c.RateLimit.Burst))
+	v.nonNegative("rate_limit.max_concurrent", float64(c.RateLimit.MaxConcurrent))
+	v.nonNegative("rate_limit.concurrency_wait", float64(c.RateLimit.ConcurrencyWait))
+
+	v.nonNegative("answer_cache.ttl", float64(c.AnswerCache.TTL))
+	if c.AnswerCache.Threshold <= 0 || c.AnswerCache.Threshold > 1 {
+		v.fail("answer_cache.threshold", "must be greater than 0 and at most 1, got %v", c.AnswerCache.Threshold)
+	}
+	v.nonNegative("answer_cache.max_entries", float64(c.AnswerCache.MaxEntries))
+
+	if c.Audit.LogPath != "" {
+		v.required("audit.user_salt", c.Audit.UserSalt)
+	}
+	v.nonNegative("audit.max_bytes", float64(c.Audit.MaxBytes))
+	v.nonNegative("audit.retention", float64(c.Audit.Retention))
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
@@ -4,47 +4,133 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 )
 
 const (
-	completionsEndpoint = "https://api.githubcopilot.com/chat/completions"
+	defaultBaseURL          = "https://api.githubcopilot.com"
+	defaultConnectTimeout   = 10 * time.Second
+	defaultFirstByteTimeout = 60 * time.Second
+	defaultRetryBackoff     = 500 * time.Millisecond
+	completionsPath         = "/chat/completions"
 )
 
+type ClientOptions struct {
+	BaseURL          string
+	ConnectTimeout   time.Duration
+	FirstByteTimeout time.Duration
+	MaxRetries       int // retries after the first attempt; 0 disables retrying
+	RetryBackoff     time.Duration
+}
+
 type Client struct {
-	httpClient *http.Client
+	httpClient   *http.Client
+	baseURL      string
+	maxRetries   int
+	retryBackoff time.Duration
+	endpoint     func(baseURL string, model Model) string
+	authorize    func(req *http.Request, integrationID, apiKey string)
 }
 
-func NewClient() *Client {
+func NewClient(opts ClientOptions) *Client {
+	if opts.BaseURL == "" {
+		opts.BaseURL = defaultBaseURL
+	}
+
+	c := newHTTPClient(opts)
+	c.endpoint = func(baseURL string, model Model) string {
+		return baseURL + completionsPath
+	}
+	c.authorize = func(req *http.Request, integrationID, apiKey string) {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		if integrationID != "" {
+			req.Header.Set("Copilot-Integration-Id", integrationID)
+		}
+	}
+	return c
+}
+
+func newHTTPClient(opts ClientOptions) *Client {
+	if opts.ConnectTimeout <= 0 {
+		opts.ConnectTimeout = defaultConnectTimeout
+	}
+	if opts.FirstByteTimeout <= 0 {
+		opts.FirstByteTimeout = defaultFirstByteTimeout
+	}
+	if opts.MaxRetries < 0 {
+		opts.MaxRetries = 0
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = defaultRetryBackoff
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   opts.ConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = opts.ConnectTimeout
+	transport.ResponseHeaderTimeout = opts.FirstByteTimeout
+
 	return &Client{
 		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Transport: transport,
 		},
+		baseURL:      strings.TrimSuffix(opts.BaseURL, "/"),
+		maxRetries:   opts.MaxRetries,
+		retryBackoff: opts.RetryBackoff,
 	}
 }
 
-func ChatCompletions(ctx context.Context, integrationID, apiKey string, req *ChatCompletionsRequest) (io.ReadCloser, error) {
+func (c *Client) ChatCompletions(ctx context.Context, integrationID, apiKey string, req *ChatCompletionsRequest) (io.ReadCloser, error) {
 	body, err := json.Marshal(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, completionsEndpoint, bytes.NewReader(body))
+	var lastErr error
+	for attempt := 0; attempt <= c.maxRetries; attempt++ {
+		if attempt > 0 {
+			delay := c.retryBackoff * time.Duration(1<<(attempt-1))
+			log.Printf("Retrying chat completion request in %v (attempt %d/%d): %v", delay, attempt, c.maxRetries, lastErr)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+
+		stream, err := c.send(ctx, integrationID, apiKey, req.Model, body)
+		if err == nil {
+			return stream, nil
+		}
+		if !isRetryable(ctx, err) {
+			return nil, err
+		}
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
+
+func (c *Client) send(ctx context.Context, integrationID, apiKey string, model Model, body []byte) (io.ReadCloser, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint(c.baseURL, model), bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("Accept", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+apiKey)
-	if integrationID != "" {
-		httpReq.Header.Set("Copilot-Integration-Id", integrationID)
-	}
+	c.authorize(httpReq, integrationID, apiKey)
 
-	resp, err := http.DefaultClient.Do(httpReq)
+	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
@@ -52,8 +138,20 @@ func ChatCompletions(ctx context.Context, integrationID, apiKey string, req *Cha
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
-		return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(body))
+		return nil, &APIError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	return resp.Body, nil
-}
\ No newline at end of file
+}
+
+func isRetryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= http.StatusInternalServerError
+	}
+	return true
+}
@@ -0,0 +1,96 @@
+package copilot
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestChatCompletionsRetriesBeforeStream(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat/completions" {
+			t.Errorf("request path = %v, want /chat/completions", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer token" {
+			t.Error("Authorization header not set correctly")
+		}
+		if r.Header.Get("Copilot-Integration-Id") != "integration" {
+			t.Error("Copilot-Integration-Id header not set correctly")
+		}
+
+		if atomic.AddInt32(&calls, 1) == 1 {
+			http.Error(w, "upstream unavailable", http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer server.Close()
+
+	client := NewClient(ClientOptions{
+		BaseURL:      server.URL,
+		MaxRetries:   2,
+		RetryBackoff: time.Millisecond,
+	})
+
+	stream, err := client.ChatCompletions(context.Background(), "integration", "token", &ChatCompletionsRequest{Model: DefaultModel, Stream: true})
+	if err != nil {
+		t.Fatalf("ChatCompletions() error = %v", err)
+	}
+	defer stream.Close()
+
+	body, _ := io.ReadAll(stream)
+	if string(body) != "data: [DONE]\n\n" {
+		t.Errorf("ChatCompletions() body = %q", body)
+	}
+
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("ChatCompletions() made %d calls, want 2", got)
+	}
+}
+
+func TestChatCompletionsDoesNotRetryClientErrors(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	client := NewClient(ClientOptions{
+		BaseURL:      server.URL,
+		MaxRetries:   3,
+		RetryBackoff: time.Millisecond,
+	})
+
+	_, err := client.ChatCompletions(context.Background(), "", "token", &ChatCompletionsRequest{})
+	apiErr, ok := err.(*APIError)
+	if !ok || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("ChatCompletions() error = %v, want APIError with status 400", err)
+	}
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("ChatCompletions() made %d calls, want 1", got)
+	}
+}
+
+func TestChatCompletionsFirstByteTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	client := NewClient(ClientOptions{
+		BaseURL:          server.URL,
+		FirstByteTimeout: 20 * time.Millisecond,
+		MaxRetries:       0,
+	})
+
+	if _, err := client.ChatCompletions(context.Background(), "", "token", &ChatCompletionsRequest{}); err == nil {
+		t.Error("ChatCompletions() error = nil, want timeout error")
+	}
+}
@@ -0,0 +1,100 @@
+package copilot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	BackendCopilot    = "copilot"
+	BackendOpenAI     = "openai"
+	BackendAzure      = "azure"
+	BackendCompatible = "compatible"
+
+	defaultOpenAIBaseURL   = "https://api.openai.com/v1"
+	defaultAzureAPIVersion = "2024-10-21"
+)
+
+type ChatBackend interface {
+	ChatCompletions(ctx context.Context, integrationID, apiKey string, req *ChatCompletionsRequest) (io.ReadCloser, error)
+}
+
+type BackendOptions struct {
+	Kind            string
+	BaseURL         string
+	APIKey          string
+	AzureAPIVersion string
+	Deployments     map[Model]string
+	Client          ClientOptions
+}
+
+func NewBackend(opts BackendOptions) (ChatBackend, error) {
+	switch strings.ToLower(opts.Kind) {
+	case "", BackendCopilot:
+		clientOpts := opts.Client
+		if opts.BaseURL != "" {
+			clientOpts.BaseURL = opts.BaseURL
+		}
+		return NewClient(clientOpts), nil
+	case BackendOpenAI:
+		if opts.APIKey == "" {
+			return nil, fmt.Errorf("openai backend requires an API key")
+		}
+		baseURL := opts.BaseURL
+		if baseURL == "" {
+			baseURL = defaultOpenAIBaseURL
+		}
+		return NewOpenAIBackend(baseURL, opts.APIKey, opts.Client), nil
+	case BackendCompatible:
+		if opts.BaseURL == "" {
+			return nil, fmt.Errorf("compatible backend requires a base URL")
+		}
+		return NewOpenAIBackend(opts.BaseURL, opts.APIKey, opts.Client), nil
+	case BackendAzure:
+		if opts.BaseURL == "" || opts.APIKey == "" {
+			return nil, fmt.Errorf("azure backend requires an endpoint and an API key")
+		}
+		return NewAzureOpenAIBackend(opts.BaseURL, opts.APIKey, opts.AzureAPIVersion, opts.Deployments, opts.Client), nil
+	}
+	return nil, fmt.Errorf("unknown chat backend %q", opts.Kind)
+}
+
+func NewOpenAIBackend(baseURL, apiKey string, opts ClientOptions) *Client {
+	opts.BaseURL = baseURL
+
+	c := newHTTPClient(opts)
+	c.endpoint = func(baseURL string, model Model) string {
+		return baseURL + completionsPath
+	}
+	c.authorize = func(req *http.Request, integrationID, userToken string) {
+		if apiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+apiKey)
+		}
+	}
+	return c
+}
+
+func NewAzureOpenAIBackend(endpoint, apiKey, apiVersion string, deployments map[Model]string, opts ClientOptions) *Client {
+	if apiVersion == "" {
+		apiVersion = defaultAzureAPIVersion
+	}
+	opts.BaseURL = endpoint
+
+	c := newHTTPClient(opts)
+	c.endpoint = func(baseURL string, model Model) string {
+		deployment, ok := deployments[model]
+		if !ok {
+			deployment = string(model)
+		}
+		return fmt.Sprintf("%s/openai/deployments/%s/chat/completions?api-version=%s",
+			baseURL, url.PathEscape(deployment), url.QueryEscape(apiVersion))
+	}
+	c.authorize = func(req *http.Request, integrationID, userToken string) {
+		req.Header.Set("api-key", apiKey)
+	}
+	return c
+}
@@ -0,0 +1,87 @@
+package copilot
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAzureOpenAIBackend(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/openai/deployments/prod-gpt4o/chat/completions" {
+			t.Errorf("request path = %v, want deployment path", r.URL.Path)
+		}
+		if r.URL.Query().Get("api-version") != "2024-06-01" {
+			t.Errorf("api-version = %v, want 2024-06-01", r.URL.Query().Get("api-version"))
+		}
+		if r.Header.Get("api-key") != "azure-key" || r.Header.Get("Authorization") != "" {
+			t.Error("Azure backend did not authenticate with the api-key header")
+		}
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer server.Close()
+
+	backend, err := NewBackend(BackendOptions{
+		Kind:            BackendAzure,
+		BaseURL:         server.URL,
+		APIKey:          "azure-key",
+		AzureAPIVersion: "2024-06-01",
+		Deployments:     map[Model]string{ModelGPT4o: "prod-gpt4o"},
+	})
+	if err != nil {
+		t.Fatalf("NewBackend() error = %v", err)
+	}
+
+	stream, err := backend.ChatCompletions(context.Background(), "integration", "user-token", &ChatCompletionsRequest{Model: ModelGPT4o})
+	if err != nil {
+		t.Fatalf("ChatCompletions() error = %v", err)
+	}
+	stream.Close()
+}
+
+func TestOpenAIBackendUsesConfiguredKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("request path = %v, want /v1/chat/completions", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer sk-test" {
+			t.Errorf("Authorization = %q, want configured key", r.Header.Get("Authorization"))
+		}
+		if r.Header.Get("Copilot-Integration-Id") != "" {
+			t.Error("OpenAI backend forwarded Copilot-Integration-Id")
+		}
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer server.Close()
+
+	backend, err := NewBackend(BackendOptions{Kind: BackendOpenAI, BaseURL: server.URL + "/v1", APIKey: "sk-test"})
+	if err != nil {
+		t.Fatalf("NewBackend() error = %v", err)
+	}
+
+	stream, err := backend.ChatCompletions(context.Background(), "integration", "user-token", &ChatCompletionsRequest{Model: ModelGPT4o})
+	if err != nil {
+		t.Fatalf("ChatCompletions() error = %v", err)
+	}
+	stream.Close()
+}
+
+func TestNewBackendValidation(t *testing.T) {
+	invalid := []BackendOptions{
+		{Kind: BackendOpenAI},
+		{Kind: BackendCompatible},
+		{Kind: BackendAzure, BaseURL: "https://example.openai.azure.com"},
+		{Kind: "bedrock"},
+	}
+
+	for _, opts := range invalid {
+		if _, err := NewBackend(opts); err == nil {
+			t.Errorf("NewBackend(%+v) error = nil, want error", opts)
+		}
+	}
+
+	if _, err := NewBackend(BackendOptions{Kind: BackendCompatible, BaseURL: "http://localhost:11434/v1"}); err != nil {
+		t.Errorf("NewBackend(compatible) error = %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package copilot
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("unexpected status code %d: %s", e.StatusCode, e.Body)
+}
+
+var modelUnavailableMarkers = []string{
+	"model_not_supported",
+	"model_not_found",
+	"model_not_available",
+	"unsupported model",
+	"model is not supported",
+}
+
+func IsModelUnavailable(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	switch apiErr.StatusCode {
+	case http.StatusNotFound, http.StatusBadRequest, http.StatusUnprocessableEntity:
+		body := strings.ToLower(apiErr.Body)
+		for _, marker := range modelUnavailableMarkers {
+			if strings.Contains(body, marker) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func IsServerError(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode >= http.StatusInternalServerError
+}
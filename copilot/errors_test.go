@@ -0,0 +1,32 @@
+package copilot
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAPIErrorClassification(t *testing.T) {
+	tests := []struct {
+		name             string
+		err              error
+		modelUnavailable bool
+		serverError      bool
+	}{
+		{"model not supported", &APIError{StatusCode: 400, Body: `{"error":{"code":"model_not_supported"}}`}, true, false},
+		{"bad request", &APIError{StatusCode: 400, Body: `{"error":"invalid messages"}`}, false, false},
+		{"bad gateway", &APIError{StatusCode: 502, Body: "bad gateway"}, false, true},
+		{"wrapped", fmt.Errorf("request failed: %w", &APIError{StatusCode: 503}), false, true},
+		{"other", fmt.Errorf("connection reset"), false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsModelUnavailable(tt.err); got != tt.modelUnavailable {
+				t.Errorf("IsModelUnavailable() = %v, want %v", got, tt.modelUnavailable)
+			}
+			if got := IsServerError(tt.err); got != tt.serverError {
+				t.Errorf("IsServerError() = %v, want %v", got, tt.serverError)
+			}
+		})
+	}
+}
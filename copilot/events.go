@@ -0,0 +1,34 @@
+package copilot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+const (
+	ErrorTypeAgent     = "agent"
+	ErrorTypeReference = "reference"
+	ErrorTypeFunction  = "function"
+
+	errorsEventName = "copilot_errors"
+)
+
+type Error struct {
+	Type       string `json:"type"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	Identifier string `json:"identifier"`
+}
+
+func WriteErrors(w io.Writer, errs ...Error) error {
+	data, err := json.Marshal(errs)
+	if err != nil {
+		return fmt.Errorf("failed to marshal errors: %w", err)
+	}
+
+	if err := WriteEvent(w, Event{Name: errorsEventName, Data: string(data)}); err != nil {
+		return err
+	}
+	return WriteDone(w)
+}
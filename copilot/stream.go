@@ -0,0 +1,336 @@
+package copilot
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const doneMarker = "[DONE]"
+
+type ChatCompletionChunk struct {
+	ID      string        `json:"id"`
+	Object  string        `json:"object,omitempty"`
+	Created int64         `json:"created,omitempty"`
+	Model   string        `json:"model,omitempty"`
+	Choices []ChunkChoice `json:"choices"`
+	Usage   *Usage        `json:"usage,omitempty"`
+}
+
+type ChunkChoice struct {
+	Index        int        `json:"index"`
+	Delta        ChunkDelta `json:"delta"`
+	FinishReason string     `json:"finish_reason,omitempty"`
+}
+
+type ChunkDelta struct {
+	Role      string          `json:"role,omitempty"`
+	Content   string          `json:"content,omitempty"`
+	ToolCalls []ToolCallDelta `json:"tool_calls,omitempty"`
+}
+
+type ToolCallDelta struct {
+	Index    int               `json:"index"`
+	ID       string            `json:"id,omitempty"`
+	Type     string            `json:"type,omitempty"`
+	Function FunctionCallDelta `json:"function"`
+}
+
+type FunctionCallDelta struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+}
+
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type Event struct {
+	Name string
+	Data string
+}
+
+func (e Event) IsMessage() bool {
+	return e.Name == "" || e.Name == "message"
+}
+
+func (e Event) Chunk() (*ChatCompletionChunk, error) {
+	var chunk ChatCompletionChunk
+	if err := json.Unmarshal([]byte(e.Data), &chunk); err != nil {
+		return nil, fmt.Errorf("failed to decode chunk: %w", err)
+	}
+	return &chunk, nil
+}
+
+type StreamDecoder struct {
+	reader *bufio.Reader
+	event  Event
+}
+
+func NewStreamDecoder(r io.Reader) *StreamDecoder {
+	return &StreamDecoder{
+		reader: bufio.NewReader(r),
+	}
+}
+
+func (d *StreamDecoder) Next() (*ChatCompletionChunk, error) {
+	for {
+		event, err := d.readEvent()
+		if err != nil {
+			return nil, err
+		}
+		d.event = event
+
+		if event.Data == doneMarker {
+			return nil, io.EOF
+		}
+		if !event.IsMessage() {
+			continue
+		}
+		return event.Chunk()
+	}
+}
+
+func (d *StreamDecoder) Event() Event {
+	return d.event
+}
+
+func (d *StreamDecoder) NextEvent() (Event, error) {
+	event, err := d.readEvent()
+	if err != nil {
+		return Event{}, err
+	}
+	d.event = event
+
+	if event.Data == doneMarker {
+		return event, io.EOF
+	}
+	return event, nil
+}
+
+func (d *StreamDecoder) readEvent() (Event, error) {
+	var event Event
+	var data []string
+	hasData := false
+
+	for {
+		line, err := d.reader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			if err == io.EOF && hasData {
+				event.Data = strings.Join(data, "\n")
+				return event, nil
+			}
+			return Event{}, err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			if !hasData {
+				event = Event{}
+				continue
+			}
+			event.Data = strings.Join(data, "\n")
+			return event, nil
+		}
+
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+
+		switch field {
+		case "event":
+			event.Name = value
+		case "data":
+			data = append(data, value)
+			hasData = true
+		}
+	}
+}
+
+func WriteEvent(w io.Writer, event Event) error {
+	var builder strings.Builder
+	if event.Name != "" {
+		builder.WriteString("event: ")
+		builder.WriteString(event.Name)
+		builder.WriteString("\n")
+	}
+	for _, line := range strings.Split(event.Data, "\n") {
+		builder.WriteString("data: ")
+		builder.WriteString(line)
+		builder.WriteString("\n")
+	}
+	builder.WriteString("\n")
+
+	if _, err := io.WriteString(w, builder.String()); err != nil {
+		return fmt.Errorf("failed to write event: %w", err)
+	}
+	return nil
+}
+
+func WriteDone(w io.Writer) error {
+	return WriteEvent(w, Event{Data: doneMarker})
+}
+
+func ContentEvent(content string) Event {
+	data, _ := json.Marshal(ChatCompletionChunk{
+		Choices: []ChunkChoice{{Delta: ChunkDelta{Role: "assistant", Content: content}}},
+	})
+	return Event{Data: string(data)}
+}
+
+type ChatCompletion struct {
+	ID      string             `json:"id"`
+	Model   string             `json:"model"`
+	Choices []CompletionChoice `json:"choices"`
+	Usage   *Usage             `json:"usage,omitempty"`
+}
+
+type CompletionChoice struct {
+	Index        int              `json:"index"`
+	Message      AssistantMessage `json:"message"`
+	FinishReason string           `json:"finish_reason"`
+}
+
+type AssistantMessage struct {
+	Role      string     `json:"role"`
+	Content   string     `json:"content"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+}
+
+type ToolCall struct {
+	ID       string       `json:"id"`
+	Type     string       `json:"type"`
+	Function FunctionCall `json:"function"`
+}
+
+type FunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+type choiceState struct {
+	role         string
+	content      strings.Builder
+	toolCalls    map[int]*ToolCall
+	finishReason string
+}
+
+type Aggregator struct {
+	id      string
+	model   string
+	usage   *Usage
+	choices map[int]*choiceState
+}
+
+func NewAggregator() *Aggregator {
+	return &Aggregator{
+		choices: make(map[int]*choiceState),
+	}
+}
+
+func (a *Aggregator) Add(chunk *ChatCompletionChunk) {
+	if chunk.ID != "" {
+		a.id = chunk.ID
+	}
+	if chunk.Model != "" {
+		a.model = chunk.Model
+	}
+	if chunk.Usage != nil {
+		a.usage = chunk.Usage
+	}
+
+	for _, choice := range chunk.Choices {
+		state, ok := a.choices[choice.Index]
+		if !ok {
+			state = &choiceState{toolCalls: make(map[int]*ToolCall)}
+			a.choices[choice.Index] = state
+		}
+
+		if choice.Delta.Role != "" {
+			state.role = choice.Delta.Role
+		}
+		state.content.WriteString(choice.Delta.Content)
+		if choice.FinishReason != "" {
+			state.finishReason = choice.FinishReason
+		}
+
+		for _, delta := range choice.Delta.ToolCalls {
+			call, ok := state.toolCalls[delta.Index]
+			if !ok {
+				call = &ToolCall{}
+				state.toolCalls[delta.Index] = call
+			}
+			if delta.ID != "" {
+				call.ID = delta.ID
+			}
+			if delta.Type != "" {
+				call.Type = delta.Type
+			}
+			call.Function.Name += delta.Function.Name
+			call.Function.Arguments += delta.Function.Arguments
+		}
+	}
+}
+
+func (a *Aggregator) Result() *ChatCompletion {
+	result := &ChatCompletion{
+		ID:    a.id,
+		Model: a.model,
+		Usage: a.usage,
+	}
+
+	for index, state := range a.choices {
+		role := state.role
+		if role == "" {
+			role = "assistant"
+		}
+
+		choice := CompletionChoice{
+			Index: index,
+			Message: AssistantMessage{
+				Role:    role,
+				Content: state.content.String(),
+			},
+			FinishReason: state.finishReason,
+		}
+
+		callIndexes := make([]int, 0, len(state.toolCalls))
+		for callIndex := range state.toolCalls {
+			callIndexes = append(callIndexes, callIndex)
+		}
+		sort.Ints(callIndexes)
+		for _, callIndex := range callIndexes {
+			choice.Message.ToolCalls = append(choice.Message.ToolCalls, *state.toolCalls[callIndex])
+		}
+
+		result.Choices = append(result.Choices, choice)
+	}
+
+	sort.Slice(result.Choices, func(i, j int) bool {
+		return result.Choices[i].Index < result.Choices[j].Index
+	})
+
+	return result
+}
+
+func (c *ChatCompletion) Content() string {
+	if len(c.Choices) == 0 {
+		return ""
+	}
+	return c.Choices[0].Message.Content
+}
+
+func (c *ChatCompletion) FinishReason() string {
+	if len(c.Choices) == 0 {
+		return ""
+	}
+	return c.Choices[0].FinishReason
+}
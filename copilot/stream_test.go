@@ -0,0 +1,112 @@
+package copilot
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+const testStream = `: keep-alive
+
+data: {"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","content":"Use "}}]}
+
+data: {"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"2023-07-01."}}]}
+
+data: {"id":"chatcmpl-1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"lookup","arguments":"{\"type\":"}}]}}]}
+
+data: {"id":"chatcmpl-1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"vaults\"}"}}]},"finish_reason":"stop"}]}
+
+data: {"id":"chatcmpl-1","choices":[],"usage":{"prompt_tokens":12,"completion_tokens":4,"total_tokens":16}}
+
+data: [DONE]
+
+`
+
+func TestStreamDecoderAndAggregator(t *testing.T) {
+	decoder := NewStreamDecoder(strings.NewReader(testStream))
+	aggregator := NewAggregator()
+
+	chunks := 0
+	for {
+		chunk, err := decoder.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		aggregator.Add(chunk)
+		chunks++
+	}
+
+	if chunks != 5 {
+		t.Errorf("Next() decoded %d chunks, want 5", chunks)
+	}
+
+	result := aggregator.Result()
+	if result.Content() != "Use 2023-07-01." {
+		t.Errorf("Result() content = %q", result.Content())
+	}
+	if result.FinishReason() != "stop" {
+		t.Errorf("Result() finish reason = %q, want stop", result.FinishReason())
+	}
+	if result.Model != "gpt-4o" {
+		t.Errorf("Result() model = %q, want gpt-4o", result.Model)
+	}
+	if result.Usage == nil || result.Usage.TotalTokens != 16 {
+		t.Errorf("Result() usage = %+v, want 16 total tokens", result.Usage)
+	}
+
+	calls := result.Choices[0].Message.ToolCalls
+	if len(calls) != 1 || calls[0].Function.Name != "lookup" || calls[0].Function.Arguments != `{"type":"vaults"}` {
+		t.Errorf("Result() tool calls = %+v", calls)
+	}
+}
+
+func TestStreamDecoderMultilineAndTrailingEvent(t *testing.T) {
+	decoder := NewStreamDecoder(strings.NewReader("event: message\ndata: {\"id\":\ndata: \"x\"}"))
+
+	chunk, err := decoder.Next()
+	if err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	if chunk.ID != "x" {
+		t.Errorf("Next() chunk ID = %q, want x", chunk.ID)
+	}
+
+	if _, err := decoder.Next(); err != io.EOF {
+		t.Errorf("Next() error = %v, want io.EOF", err)
+	}
+}
+
+func TestWriteEvent(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteEvent(&buf, Event{Name: "copilot_errors", Data: "a\nb"}); err != nil {
+		t.Fatalf("WriteEvent() error = %v", err)
+	}
+
+	want := "event: copilot_errors\ndata: a\ndata: b\n\n"
+	if buf.String() != want {
+		t.Errorf("WriteEvent() = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestStreamDecoderNextEvent(t *testing.T) {
+	stream := "event: copilot_errors\ndata: [{\"code\":\"rate_limited\"}]\n\ndata: {\"choices\":[]}\n\ndata: [DONE]\n\n"
+	decoder := NewStreamDecoder(strings.NewReader(stream))
+
+	event, err := decoder.NextEvent()
+	if err != nil || event.Name != "copilot_errors" || event.Data != `[{"code":"rate_limited"}]` {
+		t.Errorf("NextEvent() = %+v, %v, want copilot_errors event", event, err)
+	}
+
+	event, err = decoder.NextEvent()
+	if err != nil || event.Name != "" || event.Data != `{"choices":[]}` {
+		t.Errorf("NextEvent() = %+v, %v, want message event", event, err)
+	}
+
+	if _, err := decoder.NextEvent(); err != io.EOF {
+		t.Errorf("NextEvent() at [DONE] error = %v, want io.EOF", err)
+	}
+}
@@ -1,23 +1,136 @@
 package copilot
 
+import "encoding/json"
+
 type ChatMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role                 string         `json:"role"`
+	Content              string         `json:"content"`
+	Name                 string         `json:"name,omitempty"`
+	CopilotReferences    []Reference    `json:"copilot_references,omitempty"`
+	CopilotConfirmations []Confirmation `json:"copilot_confirmations,omitempty"`
 }
 
 type ChatRequest struct {
-	Messages []ChatMessage `json:"messages"`
+	Messages        []ChatMessage `json:"messages"`
+	CopilotThreadID string        `json:"copilot_thread_id,omitempty"`
+	Agent           string        `json:"agent,omitempty"`
+	Model           Model         `json:"model,omitempty"`
+}
+
+const (
+	ReferenceTypeClientFile      = "client.file"
+	ReferenceTypeClientSelection = "client.selection"
+	ReferenceTypeRepository      = "github.repository"
+)
+
+type Reference struct {
+	Type       string            `json:"type"`
+	ID         string            `json:"id"`
+	Data       json.RawMessage   `json:"data,omitempty"`
+	IsImplicit bool              `json:"is_implicit"`
+	Metadata   ReferenceMetadata `json:"metadata"`
+}
+
+type ReferenceMetadata struct {
+	DisplayName string `json:"display_name"`
+	DisplayIcon string `json:"display_icon"`
+	DisplayURL  string `json:"display_url"`
+}
+
+type FileData struct {
+	Content  string `json:"content"`
+	Language string `json:"language"`
+}
+
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type SelectionData struct {
+	Start   Position `json:"start"`
+	End     Position `json:"end"`
+	Content string   `json:"content"`
+}
+
+type Confirmation struct {
+	State        string          `json:"state"`
+	Confirmation json.RawMessage `json:"confirmation"`
+}
+
+func (r Reference) File() (*FileData, bool) {
+	if r.Type != ReferenceTypeClientFile || len(r.Data) == 0 {
+		return nil, false
+	}
+	var data FileData
+	if err := json.Unmarshal(r.Data, &data); err != nil {
+		return nil, false
+	}
+	return &data, true
+}
+
+func (r Reference) Selection() (*SelectionData, bool) {
+	if r.Type != ReferenceTypeClientSelection || len(r.Data) == 0 {
+		return nil, false
+	}
+	var data SelectionData
+	if err := json.Unmarshal(r.Data, &data); err != nil {
+		return nil, false
+	}
+	return &data, true
 }
 
 type Model string
 
 const (
-	ModelGPT35      Model = "gpt-3.5-turbo"
-	ModelGPT4       Model = "gpt-4"
+	ModelGPT4o          Model = "gpt-4o"
+	ModelGPT4oMini      Model = "gpt-4o-mini"
+	ModelGPT41          Model = "gpt-4.1"
+	ModelO3Mini         Model = "o3-mini"
+	ModelClaude35Sonnet Model = "claude-3.5-sonnet"
+
+	DefaultModel = ModelGPT4o
 )
 
 type ChatCompletionsRequest struct {
-	Messages []ChatMessage `json:"messages"`
-	Model    Model        `json:"model"`
-	Stream   bool         `json:"stream"`
-}
\ No newline at end of file
+	Messages      []ChatMessage  `json:"messages"`
+	Model         Model          `json:"model"`
+	Stream        bool           `json:"stream"`
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
+	SamplingParams
+}
+
+type SamplingParams struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	MaxTokens   *int     `json:"max_tokens,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+	Seed        *int     `json:"seed,omitempty"`
+	N           *int     `json:"n,omitempty"`
+}
+
+func (p SamplingParams) Merge(override SamplingParams) SamplingParams {
+	if override.Temperature != nil {
+		p.Temperature = override.Temperature
+	}
+	if override.TopP != nil {
+		p.TopP = override.TopP
+	}
+	if override.MaxTokens != nil {
+		p.MaxTokens = override.MaxTokens
+	}
+	if override.Stop != nil {
+		p.Stop = override.Stop
+	}
+	if override.Seed != nil {
+		p.Seed = override.Seed
+	}
+	if override.N != nil {
+		p.N = override.N
+	}
+	return p
+}
+
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
@@ -0,0 +1,151 @@
+package copilottest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/aymenfurter/bicep-copilot/copilot"
+)
+
+type Response struct {
+	Status int
+	Body   string
+	Events []copilot.Event
+}
+
+type Request struct {
+	Header http.Header
+	Body   copilot.ChatCompletionsRequest
+}
+
+type Server struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	responses []Response
+	requests  []Request
+}
+
+func NewServer(responses ...Response) *Server {
+	s := &Server{responses: responses}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+func (s *Server) Enqueue(responses ...Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses = append(s.responses, responses...)
+}
+
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+func (s *Server) CopilotClient() *copilot.Client {
+	return copilot.NewClient(copilot.ClientOptions{
+		BaseURL:    s.URL,
+		MaxRetries: 0,
+	})
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/chat/completions" {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req copilot.ChatCompletionsRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Header: r.Header.Clone(), Body: req})
+	if len(s.responses) == 0 {
+		s.mu.Unlock()
+		http.Error(w, "no scripted response left", http.StatusInternalServerError)
+		return
+	}
+	resp := s.responses[0]
+	s.responses = s.responses[1:]
+	s.mu.Unlock()
+
+	if resp.Status != 0 && resp.Status != http.StatusOK {
+		http.Error(w, resp.Body, resp.Status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	flusher, _ := w.(http.Flusher)
+	for _, event := range resp.Events {
+		if err := copilot.WriteEvent(w, event); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+func ContentStream(model string, parts ...string) Response {
+	var events []copilot.Event
+	for i, part := range parts {
+		delta := copilot.ChunkDelta{Content: part}
+		if i == 0 {
+			delta.Role = "assistant"
+		}
+		events = append(events, chunkEvent(&copilot.ChatCompletionChunk{
+			ID:      "chatcmpl-test",
+			Model:   model,
+			Choices: []copilot.ChunkChoice{{Delta: delta}},
+		}))
+	}
+
+	events = append(events, chunkEvent(&copilot.ChatCompletionChunk{
+		ID:      "chatcmpl-test",
+		Model:   model,
+		Choices: []copilot.ChunkChoice{{FinishReason: "stop"}},
+	}))
+
+	completionTokens := len(strings.Fields(strings.Join(parts, "")))
+	events = append(events, chunkEvent(&copilot.ChatCompletionChunk{
+		ID:      "chatcmpl-test",
+		Model:   model,
+		Choices: []copilot.ChunkChoice{},
+		Usage: &copilot.Usage{
+			PromptTokens:     10,
+			CompletionTokens: completionTokens,
+			TotalTokens:      10 + completionTokens,
+		},
+	}))
+
+	events = append(events, copilot.Event{Data: "[DONE]"})
+	return Response{Events: events}
+}
+
+func ErrorResponse(status int, body string) Response {
+	return Response{Status: status, Body: body}
+}
+
+func chunkEvent(chunk *copilot.ChatCompletionChunk) copilot.Event {
+	data, err := json.Marshal(chunk)
+	if err != nil {
+		panic(fmt.Sprintf("copilottest: failed to marshal chunk: %v", err))
+	}
+	return copilot.Event{Data: string(data)}
+}
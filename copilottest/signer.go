@@ -0,0 +1,120 @@
+package copilottest
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+
+	"github.com/aymenfurter/bicep-copilot/signature"
+)
+
+type Signer struct {
+	key   *ecdsa.PrivateKey
+	KeyID string
+}
+
+func NewSigner() (*Signer, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	return NewSignerFromKey(key)
+}
+
+func NewSignerFromKey(key *ecdsa.PrivateKey) (*Signer, error) {
+	keyID, err := signature.KeyIdentifier(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Signer{
+		key:   key,
+		KeyID: keyID,
+	}, nil
+}
+
+func (s *Signer) PrivateKey() *ecdsa.PrivateKey {
+	return s.key
+}
+
+func (s *Signer) PublicKey() *ecdsa.PublicKey {
+	return &s.key.PublicKey
+}
+
+func (s *Signer) PublicKeyPEM() (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(&s.key.PublicKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+func (s *Signer) Sign(payload []byte) (string, error) {
+	digest := sha256.Sum256(payload)
+	sig, err := ecdsa.SignASN1(rand.Reader, s.key, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign payload: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+func (s *Signer) SignRequest(req *http.Request, payload []byte) error {
+	sig, err := s.Sign(payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(signature.SignatureHeader, sig)
+	req.Header.Set(signature.KeyIdentifierHeader, s.KeyID)
+	return nil
+}
+
+func (s *Signer) NewRequest(url string, payload []byte) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if err := s.SignRequest(req, payload); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+type publicKey struct {
+	KeyIdentifier string `json:"key_identifier"`
+	Key           string `json:"key"`
+	IsCurrent     bool   `json:"is_current"`
+}
+
+func KeysHandler(current *Signer, others ...*Signer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var resp struct {
+			PublicKeys []publicKey `json:"public_keys"`
+		}
+
+		for i, signer := range append([]*Signer{current}, others...) {
+			key, err := signer.PublicKeyPEM()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			resp.PublicKeys = append(resp.PublicKeys, publicKey{
+				KeyIdentifier: signer.KeyID,
+				Key:           key,
+				IsCurrent:     i == 0,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
@@ -0,0 +1,31 @@
+package copilottest
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+)
+
+func TestSignerSignatureVerifies(t *testing.T) {
+	signer, err := NewSigner()
+	if err != nil {
+		t.Fatalf("NewSigner() error = %v", err)
+	}
+
+	payload := []byte(`{"messages":[]}`)
+	sig, err := signer.Sign(payload)
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+
+	der, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		t.Fatalf("signature is not base64: %v", err)
+	}
+
+	digest := sha256.Sum256(payload)
+	if !ecdsa.VerifyASN1(signer.PublicKey(), digest[:], der) {
+		t.Error("Sign() produced a signature that does not verify")
+	}
+}
@@ -2,7 +2,10 @@ module github.com/aymenfurter/bicep-copilot
 
 go 1.21
 
-require golang.org/x/oauth2 v0.17.0
+require (
+	golang.org/x/oauth2 v0.17.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/golang/protobuf v1.5.3 // indirect
@@ -11,4 +14,4 @@ require (
 	google.golang.org/protobuf v1.31.0 // indirect
 )
 
-replace github.com/aymenfurter/bicep-copilot => ./
\ No newline at end of file
+replace github.com/aymenfurter/bicep-copilot => ./
@@ -0,0 +1,50 @@
+package identity
+
+import "strings"
+
+type Policy struct {
+	Orgs  []string
+	Teams []string
+	Users []string
+}
+
+func (p Policy) Enabled() bool {
+	return len(p.Orgs) > 0 || len(p.Teams) > 0 || len(p.Users) > 0
+}
+
+func (p Policy) NeedsMemberships() bool {
+	return len(p.Orgs) > 0 || len(p.Teams) > 0
+}
+
+func (p Policy) Allows(identity *Identity) bool {
+	if !p.Enabled() {
+		return true
+	}
+	if identity == nil {
+		return false
+	}
+
+	if containsFold(p.Users, identity.Login) {
+		return true
+	}
+	for _, org := range identity.Orgs {
+		if containsFold(p.Orgs, org) {
+			return true
+		}
+	}
+	for _, team := range identity.Teams {
+		if containsFold(p.Teams, team) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, target string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, target) {
+			return true
+		}
+	}
+	return false
+}
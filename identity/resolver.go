@@ -0,0 +1,221 @@
+package identity
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultBaseURL = "https://api.github.com"
+
+	defaultCacheTTL = 10 * time.Minute
+	maxPages        = 10
+)
+
+type Identity struct {
+	ID    int64    `json:"id"`
+	Login string   `json:"login"`
+	Orgs  []string `json:"orgs,omitempty"`
+	Teams []string `json:"teams,omitempty"`
+}
+
+type ResolverOptions struct {
+	BaseURL            string
+	CacheTTL           time.Duration
+	ResolveMemberships bool
+	HTTPClient         *http.Client
+}
+
+type cacheEntry struct {
+	identity  *Identity
+	expiresAt time.Time
+}
+
+type Resolver struct {
+	baseURL            string
+	cacheTTL           time.Duration
+	resolveMemberships atomic.Bool
+	httpClient         *http.Client
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry
+	now   func() time.Time
+}
+
+func NewResolver(opts ResolverOptions) *Resolver {
+	if opts.BaseURL == "" {
+		opts.BaseURL = DefaultBaseURL
+	}
+	if opts.CacheTTL <= 0 {
+		opts.CacheTTL = defaultCacheTTL
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	r := &Resolver{
+		baseURL:    strings.TrimSuffix(opts.BaseURL, "/"),
+		cacheTTL:   opts.CacheTTL,
+		httpClient: opts.HTTPClient,
+		cache:      make(map[string]cacheEntry),
+		now:        time.Now,
+	}
+	r.resolveMemberships.Store(opts.ResolveMemberships)
+	return r
+}
+
+func (r *Resolver) SetResolveMemberships(enabled bool) {
+	if r.resolveMemberships.Swap(enabled) == enabled {
+		return
+	}
+
+	r.mu.Lock()
+	r.cache = make(map[string]cacheEntry)
+	r.mu.Unlock()
+}
+
+func (r *Resolver) Resolve(ctx context.Context, token string) (*Identity, error) {
+	if token == "" {
+		return nil, fmt.Errorf("missing GitHub token")
+	}
+
+	key := tokenKey(token)
+	r.mu.Lock()
+	entry, ok := r.cache[key]
+	r.mu.Unlock()
+	if ok && r.now().Before(entry.expiresAt) {
+		return entry.identity, nil
+	}
+
+	identity, err := r.fetch(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.cache[key] = cacheEntry{identity: identity, expiresAt: r.now().Add(r.cacheTTL)}
+	for k, e := range r.cache {
+		if r.now().After(e.expiresAt) {
+			delete(r.cache, k)
+		}
+	}
+	r.mu.Unlock()
+
+	return identity, nil
+}
+
+func (r *Resolver) fetch(ctx context.Context, token string) (*Identity, error) {
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+	}
+	if err := r.get(ctx, token, "/user", &user); err != nil {
+		return nil, fmt.Errorf("failed to resolve GitHub user: %w", err)
+	}
+
+	identity := &Identity{ID: user.ID, Login: user.Login}
+	if !r.resolveMemberships.Load() {
+		return identity, nil
+	}
+
+	for page := 1; page <= maxPages; page++ {
+		var orgs []struct {
+			Login string `json:"login"`
+		}
+		if err := r.get(ctx, token, fmt.Sprintf("/user/orgs?per_page=100&page=%d", page), &orgs); err != nil {
+			return nil, fmt.Errorf("failed to resolve organization memberships: %w", err)
+		}
+		for _, org := range orgs {
+			identity.Orgs = append(identity.Orgs, org.Login)
+		}
+		if len(orgs) < 100 {
+			break
+		}
+	}
+
+	for page := 1; page <= maxPages; page++ {
+		var teams []struct {
+			Slug         string `json:"slug"`
+			Organization struct {
+				Login string `json:"login"`
+			} `json:"organization"`
+		}
+		err := r.get(ctx, token, fmt.Sprintf("/user/teams?per_page=100&page=%d", page), &teams)
+		if isStatus(err, http.StatusForbidden, http.StatusNotFound) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve team memberships: %w", err)
+		}
+		for _, team := range teams {
+			identity.Teams = append(identity.Teams, team.Organization.Login+"/"+team.Slug)
+		}
+		if len(teams) < 100 {
+			break
+		}
+	}
+
+	return identity, nil
+}
+
+type statusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d: %s", e.StatusCode, e.Body)
+}
+
+func isStatus(err error, codes ...int) bool {
+	statusErr, ok := err.(*statusError)
+	if !ok {
+		return false
+	}
+	for _, code := range codes {
+		if statusErr.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Resolver) get(ctx context.Context, token, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.baseURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &statusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+func tokenKey(token string) string {
+	digest := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(digest[:])
+}
@@ -0,0 +1,87 @@
+package identity
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func fakeGitHub(t *testing.T, calls *int32) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		if r.Header.Get("Authorization") != "Bearer gho_token" {
+			http.Error(w, `{"message":"Bad credentials"}`, http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/user":
+			w.Write([]byte(`{"id":1,"login":"octocat"}`))
+		case "/user/orgs":
+			w.Write([]byte(`[{"login":"contoso"}]`))
+		case "/user/teams":
+			w.Write([]byte(`[{"slug":"platform","organization":{"login":"contoso"}}]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestResolverCachesIdentity(t *testing.T) {
+	var calls int32
+	server := fakeGitHub(t, &calls)
+	defer server.Close()
+
+	resolver := NewResolver(ResolverOptions{BaseURL: server.URL, ResolveMemberships: true})
+
+	for i := 0; i < 2; i++ {
+		user, err := resolver.Resolve(context.Background(), "gho_token")
+		if err != nil {
+			t.Fatalf("Resolve() error = %v", err)
+		}
+		if user.Login != "octocat" || len(user.Orgs) != 1 || user.Teams[0] != "contoso/platform" {
+			t.Errorf("Resolve() = %+v", user)
+		}
+	}
+
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("GitHub API called %d times, want 3", got)
+	}
+
+	if _, err := resolver.Resolve(context.Background(), "bad-token"); err == nil {
+		t.Error("Resolve() with bad token error = nil, want error")
+	}
+}
+
+func TestPolicyAllows(t *testing.T) {
+	user := &Identity{Login: "octocat", Orgs: []string{"contoso"}, Teams: []string{"contoso/platform"}}
+
+	tests := []struct {
+		name   string
+		policy Policy
+		want   bool
+	}{
+		{"disabled", Policy{}, true},
+		{"org", Policy{Orgs: []string{"Contoso"}}, true},
+		{"team", Policy{Teams: []string{"contoso/platform"}}, true},
+		{"user", Policy{Users: []string{"OctoCat"}}, true},
+		{"other org", Policy{Orgs: []string{"fabrikam"}}, false},
+		{"other team", Policy{Teams: []string{"contoso/security"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Allows(user); got != tt.want {
+				t.Errorf("Allows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if (Policy{Users: []string{"octocat"}}).Allows(nil) {
+		t.Error("Allows(nil) = true, want false for enabled policy")
+	}
+}
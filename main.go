@@ -2,10 +2,6 @@ package main
 
 import (
 	"context"
-	"crypto/ecdsa"
-	"crypto/x509"
-	"encoding/json"
-	"encoding/pem"
 	"fmt"
 	"log"
 	"net/http"
@@ -16,11 +12,19 @@ import (
 
 	"github.com/aymenfurter/bicep-copilot/agent"
 	"github.com/aymenfurter/bicep-copilot/config"
+	"github.com/aymenfurter/bicep-copilot/copilot"
+	"github.com/aymenfurter/bicep-copilot/identity"
 	"github.com/aymenfurter/bicep-copilot/oauth"
 	"github.com/aymenfurter/bicep-copilot/retrieval"
+	"github.com/aymenfurter/bicep-copilot/signature"
+	"github.com/aymenfurter/bicep-copilot/usage"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(runConfigCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
 	if err := run(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
@@ -33,49 +37,202 @@ func run() error {
 		return fmt.Errorf("error loading config: %w", err)
 	}
 
-	if os.Getenv("OPENAI_API_KEY") == "" {
-		return fmt.Errorf("OPENAI_API_KEY environment variable is required")
-	}
+	// The embeddings client reads its key from the environment.
+	os.Setenv("OPENAI_API_KEY", cfg.Retrieval.OpenAIKey)
 
-	pubKey, err := fetchPublicKey()
-	if err != nil {
-		return fmt.Errorf("failed to fetch public key: %w", err)
+	var keySet *signature.KeySet
+	if cfg.IsDevelopment() {
+		devKeyPath := cfg.Signature.DevSigningKeyPath
+		if devKeyPath == "" {
+			devKeyPath = signature.DefaultDevKeyPath()
+		}
+
+		devKey, err := signature.LoadOrCreateDevKey(devKeyPath)
+		if err != nil {
+			return fmt.Errorf("failed to load development signing key: %w", err)
+		}
+		keySet, err = signature.NewDevKeySet(devKey)
+		if err != nil {
+			return fmt.Errorf("failed to create development key set: %w", err)
+		}
+		log.Printf("WARNING: ENVIRONMENT=development. Requests signed by GitHub are REJECTED and payloads signed with the local key %s are trusted. Never run this mode in a deployment.", devKeyPath)
+	} else {
+		keySet = signature.NewKeySet(signature.KeySetOptions{
+			URL:                cfg.Signature.PublicKeysURL,
+			RefreshInterval:    cfg.Signature.RefreshInterval,
+			MinRefreshInterval: cfg.Signature.MinRefreshInterval,
+		})
+		if err := keySet.Refresh(context.Background()); err != nil {
+			return fmt.Errorf("failed to fetch public keys: %w", err)
+		}
+		go keySet.Run(context.Background())
 	}
 
-	callbackURL, err := url.Parse(cfg.FQDN)
+	callbackURL, err := url.Parse(cfg.Server.FQDN)
 	if err != nil {
 		return fmt.Errorf("invalid FQDN: %w", err)
 	}
 	callbackURL.Path = "auth/callback"
 
-	oauthService := oauth.NewService(cfg.ClientID, cfg.ClientSecret, callbackURL.String())
+	var tokenStore *oauth.TokenStore
+	if cfg.OAuth.TokenEncryptionKey != "" {
+		key, err := oauth.ParseEncryptionKey(cfg.OAuth.TokenEncryptionKey)
+		if err != nil {
+			return fmt.Errorf("invalid TOKEN_ENCRYPTION_KEY: %w", err)
+		}
+
+		tokenStorePath := cfg.OAuth.TokenStorePath
+		if tokenStorePath == "" {
+			tokenStorePath = oauth.DefaultTokenStorePath()
+		}
+
+		tokenStore, err = oauth.NewTokenStore(tokenStorePath, key)
+		if err != nil {
+			return fmt.Errorf("failed to open token store: %w", err)
+		}
+	} else {
+		log.Println("TOKEN_ENCRYPTION_KEY not set, OAuth tokens will not be persisted")
+	}
+
+	var stateStore oauth.StateStore
+	if cfg.OAuth.StateDir != "" {
+		stateStore, err = oauth.NewFileStateStore(cfg.OAuth.StateDir, cfg.OAuth.StateTTL)
+		if err != nil {
+			return fmt.Errorf("failed to create OAuth state store: %w", err)
+		}
+	}
+
+	oauthService := oauth.NewService(cfg.OAuth.ClientID, cfg.OAuth.ClientSecret, callbackURL.String(), oauth.Options{
+		Tokens:   tokenStore,
+		States:   stateStore,
+		StateTTL: cfg.OAuth.StateTTL,
+		Identity: identity.NewResolver(identity.ResolverOptions{
+			BaseURL: cfg.Access.GitHubAPIURL,
+		}),
+	})
 	http.HandleFunc("/auth/authorization", oauthService.PreAuth)
 	http.HandleFunc("/auth/callback", oauthService.PostAuth)
 
+	usageRecorder, err := usage.NewRecorder(cfg.Usage.LogPath)
+	if err != nil {
+		return fmt.Errorf("failed to create usage recorder: %w", err)
+	}
+	defer usageRecorder.Close()
+
+	if cfg.Server.AdminToken != "" {
+		http.HandleFunc("/admin/usage", usageRecorder.Handler(cfg.Server.AdminToken))
+	}
+
+	var auditLog *agent.AuditLog
+	if cfg.Audit.LogPath != "" {
+		auditLog, err = agent.NewAuditLog(agent.AuditOptions{
+			Path:      cfg.Audit.LogPath,
+			MaxBytes:  cfg.Audit.MaxBytes,
+			Retention: cfg.Audit.Retention,
+			UserSalt:  cfg.Audit.UserSalt,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create audit log: %w", err)
+		}
+		defer auditLog.Close()
+	}
+
 	repoConfig := &retrieval.RepoConfig{
-		Owner:    cfg.RepoOwner,
-		Repo:     cfg.RepoName,
-		Branch:   cfg.RepoBranch,
-		RootPath: cfg.RepoPath,
+		Owner:    cfg.Retrieval.RepoOwner,
+		Repo:     cfg.Retrieval.RepoName,
+		Branch:   cfg.Retrieval.RepoBranch,
+		RootPath: cfg.Retrieval.RepoPath,
 	}
 
-	retrievalService, err := retrieval.NewService(repoConfig)
+	retrievalService, err := retrieval.NewService(repoConfig, usageRecorder)
 	if err != nil {
 		return fmt.Errorf("failed to create retrieval service: %w", err)
 	}
+	retrievalService.SetTopK(cfg.Retrieval.TopK)
+
+	go func() {
+		log.Println("Initializing document embeddings in the background...")
+		startTime := time.Now()
+		retrievalService.Run(context.Background(), 30*time.Second)
+		log.Printf("Document embeddings initialized in %v", time.Since(startTime))
+	}()
+
+	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, "ok")
+	})
+	http.HandleFunc("/readyz", retrievalService.ReadinessHandler())
+
+	deployments := make(map[copilot.Model]string)
+	for model, deployment := range cfg.ChatBackend.AzureDeployments {
+		deployments[copilot.Model(model)] = deployment
+	}
+
+	chatBackend, err := copilot.NewBackend(copilot.BackendOptions{
+		Kind:            cfg.ChatBackend.Kind,
+		BaseURL:         cfg.ChatBackend.BaseURL,
+		APIKey:          cfg.ChatBackend.APIKey,
+		AzureAPIVersion: cfg.ChatBackend.AzureAPIVersion,
+		Deployments:     deployments,
+		Client: copilot.ClientOptions{
+			BaseURL:          cfg.Copilot.BaseURL,
+			ConnectTimeout:   cfg.Copilot.ConnectTimeout,
+			FirstByteTimeout: cfg.Copilot.FirstByteTimeout,
+			MaxRetries:       cfg.Copilot.MaxRetries,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create chat backend: %w", err)
+	}
+	log.Printf("Using %s chat backend", cfg.ChatBackend.Kind)
+
+	var answerCache *agent.AnswerCache
+	if cfg.AnswerCache.TTL > 0 {
+		answerCache = agent.NewAnswerCache(retrievalService, agent.AnswerCacheOptions{
+			TTL:        cfg.AnswerCache.TTL,
+			Threshold:  float32(cfg.AnswerCache.Threshold),
+			MaxEntries: cfg.AnswerCache.MaxEntries,
+		})
+	}
 
-	log.Println("Initializing document embeddings...")
-	startTime := time.Now()
-	if err := retrievalService.Initialize(context.Background()); err != nil {
-		return fmt.Errorf("failed to initialize documents: %w", err)
+	settings, err := agentSettings(cfg)
+	if err != nil {
+		return err
 	}
-	log.Printf("Document embeddings initialized in %v", time.Since(startTime))
 
-	agentService := agent.NewService(pubKey, retrievalService)
+	identityResolver := identity.NewResolver(identity.ResolverOptions{
+		BaseURL:            cfg.Access.GitHubAPIURL,
+		CacheTTL:           cfg.Access.IdentityCacheTTL,
+		ResolveMemberships: settings.Policy.NeedsMemberships(),
+	})
 
-	http.HandleFunc("/agent", agentService.ChatCompletion)
+	agentService := agent.NewService(retrievalService, agent.Options{
+		Backend:        chatBackend,
+		Prompts:        settings.Prompts,
+		Corpus:         settings.Corpus,
+		Model:          settings.Model,
+		FallbackModels: settings.FallbackModels,
+		Usage:          usageRecorder,
+		AnswerCache:    answerCache,
 
-	addr := ":" + cfg.Port
+		Sampling:        settings.Sampling,
+		CommandSampling: settings.CommandSampling,
+
+		Identity: identityResolver,
+		Policy:   settings.Policy,
+
+		RateLimit: settings.RateLimit,
+		Audit:     auditLog,
+	})
+
+	config.Watch(context.Background(), cfg, applySettings(agentService, retrievalService))
+
+	verifySignature := signature.Middleware(keySet, signature.MiddlewareOptions{
+		MaxBodyBytes: cfg.Server.MaxBodyBytes,
+	})
+	http.Handle("/agent", verifySignature(http.HandlerFunc(agentService.ChatCompletion)))
+
+	addr := ":" + cfg.Server.Port
 	server := &http.Server{
 		Addr:         addr,
 		Handler:      nil,
@@ -84,63 +241,55 @@ func run() error {
 		IdleTimeout:  60 * time.Second,
 	}
 
-	log.Printf("Server starting on port %s", cfg.Port)
+	log.Printf("Server starting on port %s", cfg.Server.Port)
 	return server.ListenAndServe()
 }
 
-func fetchPublicKey() (*ecdsa.PublicKey, error) {
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
-	
-	resp, err := client.Get("https://api.github.com/meta/public_keys/copilot_api")
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch public key: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
-
-	var respBody struct {
-		PublicKeys []struct {
-			Key       string `json:"key"`
-			IsCurrent bool   `json:"is_current"`
-		} `json:"public_keys"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	var currentKey string
-	for _, pk := range respBody.PublicKeys {
-		if pk.IsCurrent {
-			currentKey = pk.Key
-			break
+func applySettings(agentService *agent.Service, retrievalService *retrieval.Service) config.ApplyFunc {
+	return func(next *config.Config) error {
+		settings, err := agentSettings(next)
+		if err != nil {
+			return err
 		}
+		agentService.Reload(settings)
+		retrievalService.SetTopK(next.Retrieval.TopK)
+		return nil
 	}
+}
 
-	if currentKey == "" {
-		return nil, fmt.Errorf("no current public key found")
-	}
-
-	pemStr := strings.ReplaceAll(currentKey, "\\n", "\n")
-	block, _ := pem.Decode([]byte(pemStr))
-	if block == nil {
-		return nil, fmt.Errorf("failed to parse PEM block")
+func agentSettings(cfg *config.Config) (agent.Settings, error) {
+	prompts, err := agent.LoadPrompts(cfg.Model.PromptsDir)
+	if err != nil {
+		return agent.Settings{}, fmt.Errorf("failed to load prompt templates: %w", err)
 	}
 
-	key, err := x509.ParsePKIXPublicKey(block.Bytes)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	var fallbackModels []copilot.Model
+	for _, model := range cfg.Model.Fallbacks {
+		fallbackModels = append(fallbackModels, copilot.Model(model))
 	}
 
-	ecdsaKey, ok := key.(*ecdsa.PublicKey)
-	if !ok {
-		return nil, fmt.Errorf("key is not ECDSA")
+	commandSampling := make(map[string]copilot.SamplingParams)
+	for command, sampling := range cfg.Model.CommandSampling {
+		commandSampling[strings.ToLower(command)] = copilot.SamplingParams(sampling)
 	}
 
-	return ecdsaKey, nil
-}
\ No newline at end of file
+	return agent.Settings{
+		Prompts:         prompts,
+		Corpus:          cfg.Retrieval.CorpusName,
+		Model:           copilot.Model(cfg.Model.Name),
+		FallbackModels:  fallbackModels,
+		Sampling:        copilot.SamplingParams(cfg.Model.Sampling),
+		CommandSampling: commandSampling,
+		Policy: identity.Policy{
+			Orgs:  cfg.Access.AllowedOrgs,
+			Teams: cfg.Access.AllowedTeams,
+			Users: cfg.Access.AllowedUsers,
+		},
+		RateLimit: agent.RateLimitOptions{
+			RequestsPerMinute: cfg.RateLimit.RequestsPerMinute,
+			Burst:             cfg.RateLimit.Burst,
+			MaxConcurrent:     cfg.RateLimit.MaxConcurrent,
+			ConcurrencyWait:   cfg.RateLimit.ConcurrencyWait,
+		},
+	}, nil
+}
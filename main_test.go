@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aymenfurter/bicep-copilot/agent"
+	"github.com/aymenfurter/bicep-copilot/config"
+	"github.com/aymenfurter/bicep-copilot/retrieval"
+)
+
+const (
+	testClientSecret = "client-secret-from-dotenv"
+	testOpenAIKey    = "sk-openai-from-env"
+)
+
+func setupConfigCommand(t *testing.T, env map[string]string, dotenv string) {
+	t.Helper()
+	for _, setting := range (&config.Config{}).Settings() {
+		if setting.Env != "" {
+			t.Setenv(setting.Env, "")
+		}
+	}
+	t.Setenv("CONFIG_FILE", "")
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+
+	dir := t.TempDir()
+	if dotenv != "" {
+		if err := os.WriteFile(filepath.Join(dir, ".env"), []byte(dotenv), 0600); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+	origWd, _ := os.Getwd()
+	os.Chdir(dir)
+	t.Cleanup(func() { os.Chdir(origWd) })
+}
+
+func TestRunConfigCommand(t *testing.T) {
+	validEnv := map[string]string{
+		"ENVIRONMENT":    "production",
+		"FQDN":           "https://copilot.example.com",
+		"CLIENT_ID":      "Iv1.client",
+		"REPO_OWNER":     "Azure",
+		"REPO_NAME":      "bicep-types-az",
+		"OPENAI_API_KEY": testOpenAIKey,
+	}
+	withEnv := func(overrides map[string]string) map[string]string {
+		env := make(map[string]string)
+		for key, value := range validEnv {
+			env[key] = value
+		}
+		for key, value := range overrides {
+			env[key] = value
+		}
+		return env
+	}
+
+	tests := []struct {
+		name       string
+		args       []string
+		env        map[string]string
+		dotenv     string
+		wantCode   int
+		wantStdout string
+		wantStderr string
+	}{
+		{name: "no subcommand", args: nil, wantCode: 2, wantStderr: configUsage},
+		{name: "unknown subcommand", args: []string{"validate"}, wantCode: 2, wantStderr: configUsage},
+		{name: "extra arguments", args: []string{"check", "now"}, wantCode: 2, wantStderr: configUsage},
+		{
+			name:       "missing config file",
+			args:       []string{"check"},
+			env:        withEnv(map[string]string{"CONFIG_FILE": "missing.yaml"}),
+			wantCode:   1,
+			wantStderr: "Error: config file from CONFIG_FILE",
+		},
+		{
+			name:       "invalid .env file",
+			args:       []string{"check"},
+			env:        validEnv,
+			dotenv:     "CLIENT_SECRET=\"" + testClientSecret + "\n",
+			wantCode:   1,
+			wantStderr: "unterminated double-quoted value",
+		},
+		{
+			name:       "validation errors",
+			args:       []string{"check"},
+			env:        withEnv(map[string]string{"PORT": "0"}),
+			dotenv:     "CLIENT_SECRET=" + testClientSecret + "\n",
+			wantCode:   1,
+			wantStdout: "server.port",
+			wantStderr: "server.port (PORT): must be a port number",
+		},
+		{
+			name:       "valid",
+			args:       []string{"check"},
+			env:        validEnv,
+			dotenv:     "CLIENT_SECRET=" + testClientSecret + "\n",
+			wantCode:   0,
+			wantStdout: "Configuration is valid.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupConfigCommand(t, tt.env, tt.dotenv)
+
+			var stdout, stderr bytes.Buffer
+			if code := runConfigCommand(tt.args, &stdout, &stderr); code != tt.wantCode {
+				t.Errorf("runConfigCommand() = %d, want %d\nstdout:\n%s\nstderr:\n%s", code, tt.wantCode, stdout.String(), stderr.String())
+			}
+			if !strings.Contains(stdout.String(), tt.wantStdout) {
+				t.Errorf("stdout = %q, want it to contain %q", stdout.String(), tt.wantStdout)
+			}
+			if !strings.Contains(stderr.String(), tt.wantStderr) {
+				t.Errorf("stderr = %q, want it to contain %q", stderr.String(), tt.wantStderr)
+			}
+
+			for _, secret := range []string{testClientSecret, testOpenAIKey} {
+				if strings.Contains(stdout.String()+stderr.String(), secret) {
+					t.Errorf("runConfigCommand() output contains secret %q", secret)
+				}
+			}
+		})
+	}
+}
+
+func TestApplySettingsReloadsPromptTemplates(t *testing.T) {
+	setupConfigCommand(t, map[string]string{"OPENAI_API_KEY": testOpenAIKey}, "")
+
+	promptsDir := t.TempDir()
+	template := filepath.Join(promptsDir, "system.tmpl")
+	if err := os.WriteFile(template, []byte("v1 prompt for {{.Corpus}}"), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "bicep-copilot.yaml")
+	content := "server:\n  environment: development\nretrieval:\n  repo_owner: Azure\n  repo_name: bicep-types-az\nmodel:\n  prompts_dir: " + promptsDir + "\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	settings, err := agentSettings(cfg)
+	if err != nil {
+		t.Fatalf("agentSettings() error = %v", err)
+	}
+	agentService := agent.NewService(nil, agent.Options{Prompts: settings.Prompts, Corpus: settings.Corpus})
+	retrievalService, err := retrieval.NewService(nil, nil)
+	if err != nil {
+		t.Fatalf("retrieval.NewService() error = %v", err)
+	}
+	apply := applySettings(agentService, retrievalService)
+
+	if err := os.WriteFile(template, []byte("v2 prompt for {{.Corpus}}"), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if err := apply(cfg); err != nil {
+		t.Fatalf("apply() error = %v", err)
+	}
+
+	current := agentService.Settings()
+	got, err := current.Prompts.System(&agent.PromptData{Corpus: current.Corpus})
+	if err != nil {
+		t.Fatalf("System() error = %v", err)
+	}
+	if got != "v2 prompt for Azure/bicep-types-az" {
+		t.Errorf("System() after reload = %q, want the edited template", got)
+	}
+}
@@ -5,11 +5,13 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
-	"sync"
 	"time"
 
+	"github.com/aymenfurter/bicep-copilot/identity"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/github"
 )
@@ -21,13 +23,20 @@ const (
 
 type Service struct {
 	config     *oauth2.Config
-	states     sync.Map
-	pkceCodes  sync.Map
+	states     StateStore
 	maxAge     time.Duration
-	cleanupMtx sync.Mutex
+	tokens     *TokenStore
+	identity   *identity.Resolver
 }
 
-func NewService(clientID, clientSecret, callbackURL string) *Service {
+type Options struct {
+	Tokens   *TokenStore
+	Identity *identity.Resolver
+	States   StateStore
+	StateTTL time.Duration
+}
+
+func NewService(clientID, clientSecret, callbackURL string, opts Options) *Service {
 	config := &oauth2.Config{
 		ClientID:     clientID,
 		ClientSecret: clientSecret,
@@ -36,9 +45,22 @@ func NewService(clientID, clientSecret, callbackURL string) *Service {
 		Endpoint:     github.Endpoint,
 	}
 
+	if opts.StateTTL <= 0 {
+		opts.StateTTL = defaultStateTTL
+	}
+	if opts.States == nil {
+		opts.States = NewMemoryStateStore(opts.StateTTL)
+	}
+	if opts.Tokens != nil && opts.Identity == nil {
+		opts.Identity = identity.NewResolver(identity.ResolverOptions{})
+	}
+
 	s := &Service{
-		config: config,
-		maxAge: 10 * time.Minute,
+		config:   config,
+		states:   opts.States,
+		maxAge:   opts.StateTTL,
+		tokens:   opts.Tokens,
+		identity: opts.Identity,
 	}
 
 	go s.cleanupRoutine()
@@ -59,8 +81,11 @@ func (s *Service) PreAuth(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.states.Store(state, time.Now())
-	s.pkceCodes.Store(state, codeVerifier)
+	if err := s.states.Save(state, codeVerifier); err != nil {
+		log.Printf("Failed to save OAuth state: %v", err)
+		http.Error(w, "Failed to save state", http.StatusInternalServerError)
+		return
+	}
 
 	http.SetCookie(w, &http.Cookie{
 		Name:     stateCookieName,
@@ -99,21 +124,29 @@ func (s *Service) PostAuth(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	codeVerifierI, ok := s.pkceCodes.LoadAndDelete(state)
-	if !ok {
+	codeVerifier, err := s.states.Consume(state)
+	if err != nil {
+		if !errors.Is(err, ErrStateNotFound) {
+			log.Printf("Failed to load OAuth state: %v", err)
+		}
 		http.Error(w, "Invalid or expired session", http.StatusBadRequest)
 		return
 	}
-	codeVerifier := codeVerifierI.(string)
 
 	ctx := context.Background()
-	_, err = s.config.Exchange(ctx, code,
+	token, err := s.config.Exchange(ctx, code,
 		oauth2.SetAuthURLParam("code_verifier", codeVerifier))
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to exchange token: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	if err := s.storeToken(ctx, token); err != nil {
+		log.Printf("Failed to store OAuth token: %v", err)
+		http.Error(w, "Failed to store token", http.StatusInternalServerError)
+		return
+	}
+
 	http.SetCookie(w, &http.Cookie{
 		Name:     stateCookieName,
 		Value:    "",
@@ -124,8 +157,6 @@ func (s *Service) PostAuth(w http.ResponseWriter, r *http.Request) {
 		SameSite: http.SameSiteLaxMode,
 	})
 
-	s.states.Delete(state)
-
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, `
@@ -148,25 +179,31 @@ func (s *Service) PostAuth(w http.ResponseWriter, r *http.Request) {
 	`)
 }
 
+func (s *Service) storeToken(ctx context.Context, token *oauth2.Token) error {
+	if s.tokens == nil {
+		return nil
+	}
+
+	user, err := s.identity.Resolve(ctx, token.AccessToken)
+	if err != nil {
+		return err
+	}
+
+	if err := s.tokens.Put(user.ID, token); err != nil {
+		return err
+	}
+	log.Printf("Stored OAuth token for GitHub user %s", user.Login)
+	return nil
+}
+
 func (s *Service) cleanupRoutine() {
 	ticker := time.NewTicker(time.Minute)
 	defer ticker.Stop()
 
 	for range ticker.C {
-		s.cleanupMtx.Lock()
-		now := time.Now()
-
-		s.states.Range(func(k, v interface{}) bool {
-			if timestamp, ok := v.(time.Time); ok {
-				if now.Sub(timestamp) > s.maxAge {
-					s.states.Delete(k)
-					s.pkceCodes.Delete(k)
-				}
-			}
-			return true
-		})
-
-		s.cleanupMtx.Unlock()
+		if err := s.states.Cleanup(); err != nil {
+			log.Printf("Failed to clean up OAuth states: %v", err)
+		}
 	}
 }
 
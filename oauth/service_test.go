@@ -14,7 +14,7 @@ const (
 )
 
 func TestNewService(t *testing.T) {
-	service := NewService(testClientID, testClientSecret, testCallbackURL)
+	service := NewService(testClientID, testClientSecret, testCallbackURL, Options{})
 	
 	if service.config.ClientID != testClientID {
 		t.Errorf("NewService() ClientID = %v, want %v", service.config.ClientID, testClientID)
@@ -26,7 +26,7 @@ func TestNewService(t *testing.T) {
 }
 
 func TestPreAuth(t *testing.T) {
-	service := NewService(testClientID, testClientSecret, testCallbackURL)
+	service := NewService(testClientID, testClientSecret, testCallbackURL, Options{})
 	
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("GET", "/auth", nil)
@@ -0,0 +1,190 @@
+package oauth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultStateTTL = 10 * time.Minute
+	stateFileSuffix = ".json"
+	tempFileSuffix  = ".tmp"
+)
+
+var ErrStateNotFound = errors.New("oauth state not found or expired")
+
+type StateStore interface {
+	Save(state, codeVerifier string) error
+	Consume(state string) (string, error)
+	Cleanup() error
+}
+
+type stateEntry struct {
+	CodeVerifier string    `json:"code_verifier"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type MemoryStateStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]stateEntry
+	now     func() time.Time
+}
+
+func NewMemoryStateStore(ttl time.Duration) *MemoryStateStore {
+	if ttl <= 0 {
+		ttl = defaultStateTTL
+	}
+
+	return &MemoryStateStore{
+		ttl:     ttl,
+		entries: make(map[string]stateEntry),
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStateStore) Save(state, codeVerifier string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[state] = stateEntry{CodeVerifier: codeVerifier, CreatedAt: s.now()}
+	return nil
+}
+
+func (s *MemoryStateStore) Consume(state string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[state]
+	if !ok {
+		return "", ErrStateNotFound
+	}
+	delete(s.entries, state)
+
+	if s.now().Sub(entry.CreatedAt) > s.ttl {
+		return "", ErrStateNotFound
+	}
+	return entry.CodeVerifier, nil
+}
+
+func (s *MemoryStateStore) Cleanup() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for state, entry := range s.entries {
+		if now.Sub(entry.CreatedAt) > s.ttl {
+			delete(s.entries, state)
+		}
+	}
+	return nil
+}
+
+type FileStateStore struct {
+	dir string
+	ttl time.Duration
+	now func() time.Time
+}
+
+func NewFileStateStore(dir string, ttl time.Duration) (*FileStateStore, error) {
+	if ttl <= 0 {
+		ttl = defaultStateTTL
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	return &FileStateStore{
+		dir: dir,
+		ttl: ttl,
+		now: time.Now,
+	}, nil
+}
+
+func (s *FileStateStore) Save(state, codeVerifier string) error {
+	data, err := json.Marshal(stateEntry{CodeVerifier: codeVerifier, CreatedAt: s.now()})
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	path := s.path(state)
+	tmp := path + tempFileSuffix
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	return nil
+}
+
+func (s *FileStateStore) Consume(state string) (string, error) {
+	path := s.path(state)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrStateNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read state: %w", err)
+	}
+
+	// Removing the file claims the state, so a callback replayed against
+	// another replica cannot use the same code verifier twice.
+	if err := os.Remove(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", ErrStateNotFound
+		}
+		return "", fmt.Errorf("failed to remove state: %w", err)
+	}
+
+	var entry stateEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return "", fmt.Errorf("failed to decode state: %w", err)
+	}
+	if s.now().Sub(entry.CreatedAt) > s.ttl {
+		return "", ErrStateNotFound
+	}
+	return entry.CodeVerifier, nil
+}
+
+func (s *FileStateStore) Cleanup() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("failed to list state directory: %w", err)
+	}
+
+	// Temporary files are swept too, in case a replica crashed between
+	// writing and renaming one.
+	now := s.now()
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !(strings.HasSuffix(name, stateFileSuffix) || strings.HasSuffix(name, stateFileSuffix+tempFileSuffix)) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if now.Sub(info.ModTime()) > s.ttl {
+			os.Remove(filepath.Join(s.dir, name))
+		}
+	}
+	return nil
+}
+
+func (s *FileStateStore) path(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+stateFileSuffix)
+}
@@ -0,0 +1,107 @@
+package oauth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemoryStateStoreExpiry(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryStateStore(time.Minute)
+	store.now = func() time.Time { return now }
+
+	store.Save("fresh", "verifier-1")
+	store.Save("stale", "verifier-2")
+
+	if verifier, err := store.Consume("fresh"); err != nil || verifier != "verifier-1" {
+		t.Errorf("Consume(fresh) = %q, %v, want verifier-1", verifier, err)
+	}
+	if _, err := store.Consume("fresh"); err != ErrStateNotFound {
+		t.Errorf("Consume(fresh) again error = %v, want ErrStateNotFound", err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := store.Consume("stale"); err != ErrStateNotFound {
+		t.Errorf("Consume(stale) error = %v, want ErrStateNotFound", err)
+	}
+
+	store.Save("old", "verifier-3")
+	now = now.Add(2 * time.Minute)
+	store.Cleanup()
+	if len(store.entries) != 0 {
+		t.Errorf("Cleanup() left %d entries, want 0", len(store.entries))
+	}
+}
+
+func TestFileStateStoreSharedAcrossReplicas(t *testing.T) {
+	dir := t.TempDir()
+
+	first, err := NewFileStateStore(dir, time.Minute)
+	if err != nil {
+		t.Fatalf("NewFileStateStore() error = %v", err)
+	}
+	second, err := NewFileStateStore(dir, time.Minute)
+	if err != nil {
+		t.Fatalf("NewFileStateStore() error = %v", err)
+	}
+
+	if err := first.Save("state", "verifier"); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	verifier, err := second.Consume("state")
+	if err != nil || verifier != "verifier" {
+		t.Errorf("Consume() on other replica = %q, %v, want verifier", verifier, err)
+	}
+	if _, err := first.Consume("state"); err != ErrStateNotFound {
+		t.Errorf("Consume() replay error = %v, want ErrStateNotFound", err)
+	}
+
+	now := time.Now()
+	first.now = func() time.Time { return now }
+	first.Save("expired", "verifier")
+	first.now = func() time.Time { return now.Add(2 * time.Minute) }
+	if _, err := first.Consume("expired"); err != ErrStateNotFound {
+		t.Errorf("Consume(expired) error = %v, want ErrStateNotFound", err)
+	}
+}
+
+func TestFileStateStoreRemovesTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStateStore(dir, time.Minute)
+	if err != nil {
+		t.Fatalf("NewFileStateStore() error = %v", err)
+	}
+
+	blocked := store.path("blocked")
+	if err := os.MkdirAll(filepath.Join(blocked, "occupied"), 0o700); err != nil {
+		t.Fatalf("MkdirAll() error = %v", err)
+	}
+	if err := store.Save("blocked", "verifier"); err == nil {
+		t.Fatal("Save() over a directory error = nil, want error")
+	}
+	if _, err := os.Stat(blocked + tempFileSuffix); !os.IsNotExist(err) {
+		t.Errorf("Save() left %s behind after a failed rename", filepath.Base(blocked+tempFileSuffix))
+	}
+
+	stale := filepath.Join(dir, "crashed"+stateFileSuffix+tempFileSuffix)
+	unrelated := filepath.Join(dir, "notes.txt")
+	for _, path := range []string{stale, unrelated} {
+		if err := os.WriteFile(path, []byte("{}"), 0o600); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+
+	store.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if err := store.Cleanup(); err != nil {
+		t.Fatalf("Cleanup() error = %v", err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("Cleanup() kept an expired temporary state file")
+	}
+	if _, err := os.Stat(unrelated); err != nil {
+		t.Errorf("Cleanup() removed an unrelated file: %v", err)
+	}
+}
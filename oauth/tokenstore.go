@@ -0,0 +1,177 @@
+package oauth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	defaultTokenDir  = ".bicep-copilot"
+	defaultTokenFile = "tokens.enc"
+
+	tokenStoreAAD = "bicep-copilot/tokens/v1"
+)
+
+var ErrNoToken = errors.New("no token stored for user")
+
+// TokenStore keeps tokens in memory and rewrites the whole file on every
+// change, so it must only be used by a single process: replicas sharing the
+// file would overwrite each other's tokens.
+type TokenStore struct {
+	mu     sync.Mutex
+	path   string
+	aead   cipher.AEAD
+	tokens map[int64]*oauth2.Token
+}
+
+func DefaultTokenStorePath() string {
+	return filepath.Join(os.Getenv("HOME"), defaultTokenDir, defaultTokenFile)
+}
+
+func ParseEncryptionKey(value string) ([]byte, error) {
+	if key, err := hex.DecodeString(value); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(value); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	return nil, fmt.Errorf("encryption key must be 32 bytes encoded as hex or base64")
+}
+
+func NewTokenStore(path string, key []byte) (*TokenStore, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	s := &TokenStore{
+		path:   path,
+		aead:   aead,
+		tokens: make(map[int64]*oauth2.Token),
+	}
+
+	if path == "" {
+		return s, nil
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *TokenStore) Get(userID int64) (*oauth2.Token, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[userID]
+	if !ok {
+		return nil, false
+	}
+	copied := *token
+	return &copied, true
+}
+
+func (s *TokenStore) Put(userID int64, token *oauth2.Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, existed := s.tokens[userID]
+	copied := *token
+	s.tokens[userID] = &copied
+	if err := s.save(); err != nil {
+		if existed {
+			s.tokens[userID] = previous
+		} else {
+			delete(s.tokens, userID)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *TokenStore) Delete(userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.tokens[userID]
+	if !ok {
+		return nil
+	}
+	delete(s.tokens, userID)
+	if err := s.save(); err != nil {
+		s.tokens[userID] = previous
+		return err
+	}
+	return nil
+}
+
+func (s *TokenStore) load() error {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read token store: %w", err)
+	}
+
+	nonceSize := s.aead.NonceSize()
+	if len(data) < nonceSize {
+		return fmt.Errorf("token store %s is corrupt", s.path)
+	}
+
+	plaintext, err := s.aead.Open(nil, data[:nonceSize], data[nonceSize:], []byte(tokenStoreAAD))
+	if err != nil {
+		return fmt.Errorf("failed to decrypt token store %s: %w", s.path, err)
+	}
+
+	if err := json.Unmarshal(plaintext, &s.tokens); err != nil {
+		return fmt.Errorf("failed to decode token store: %w", err)
+	}
+	return nil
+}
+
+func (s *TokenStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	plaintext, err := json.Marshal(s.tokens)
+	if err != nil {
+		return fmt.Errorf("failed to encode token store: %w", err)
+	}
+
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	data := s.aead.Seal(nonce, nonce, plaintext, []byte(tokenStoreAAD))
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return fmt.Errorf("failed to create token store directory: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write token store: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to replace token store: %w", err)
+	}
+	return nil
+}
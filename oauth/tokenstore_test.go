@@ -0,0 +1,106 @@
+package oauth
+
+import (
+	"bytes"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func testKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("rand.Read() error = %v", err)
+	}
+	return key
+}
+
+func TestTokenStorePersistsEncrypted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.enc")
+	key := testKey(t)
+
+	store, err := NewTokenStore(path, key)
+	if err != nil {
+		t.Fatalf("NewTokenStore() error = %v", err)
+	}
+	if err := store.Put(42, &oauth2.Token{AccessToken: "ghu_secret", RefreshToken: "ghr_secret"}); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if bytes.Contains(data, []byte("ghu_secret")) || bytes.Contains(data, []byte("ghr_secret")) {
+		t.Error("token store file contains plaintext tokens")
+	}
+
+	reopened, err := NewTokenStore(path, key)
+	if err != nil {
+		t.Fatalf("NewTokenStore() reopen error = %v", err)
+	}
+	token, ok := reopened.Get(42)
+	if !ok || token.AccessToken != "ghu_secret" || token.RefreshToken != "ghr_secret" {
+		t.Errorf("Get(42) = %+v, %v, want stored token", token, ok)
+	}
+
+	if _, err := NewTokenStore(path, testKey(t)); err == nil {
+		t.Error("NewTokenStore() with wrong key error = nil, want error")
+	}
+}
+
+func TestParseEncryptionKey(t *testing.T) {
+	valid := []string{
+		"000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f",
+		"AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8=",
+	}
+	for _, value := range valid {
+		if _, err := ParseEncryptionKey(value); err != nil {
+			t.Errorf("ParseEncryptionKey(%q) error = %v", value, err)
+		}
+	}
+
+	if _, err := ParseEncryptionKey("too-short"); err == nil {
+		t.Error("ParseEncryptionKey() short key error = nil, want error")
+	}
+}
+
+func TestTokenStoreRollsBackFailedSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.enc")
+	store, err := NewTokenStore(path, testKey(t))
+	if err != nil {
+		t.Fatalf("NewTokenStore() error = %v", err)
+	}
+	if err := store.Put(42, &oauth2.Token{AccessToken: "ghu_old"}); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	if err := os.Mkdir(path+".tmp", 0o700); err != nil {
+		t.Fatalf("Mkdir() error = %v", err)
+	}
+
+	if err := store.Put(42, &oauth2.Token{AccessToken: "ghu_new"}); err == nil {
+		t.Fatal("Put() with an unwritable file error = nil, want error")
+	}
+	if token, _ := store.Get(42); token.AccessToken != "ghu_old" {
+		t.Errorf("Get() after failed Put() = %q, want ghu_old", token.AccessToken)
+	}
+
+	if err := store.Put(7, &oauth2.Token{AccessToken: "ghu_other"}); err == nil {
+		t.Fatal("Put() with an unwritable file error = nil, want error")
+	}
+	if _, ok := store.Get(7); ok {
+		t.Error("Get() after failed Put() of a new user = found, want not found")
+	}
+
+	if err := store.Delete(42); err == nil {
+		t.Fatal("Delete() with an unwritable file error = nil, want error")
+	}
+	if _, ok := store.Get(42); !ok {
+		t.Error("Get() after failed Delete() = not found, want the token kept")
+	}
+}
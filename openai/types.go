@@ -7,6 +7,7 @@ type EmbeddingsRequest struct {
 
 type EmbeddingsResponse struct {
 	Data  []EmbeddingData `json:"data"`
+	Model string          `json:"model"`
 	Usage UsageInfo       `json:"usage"`
 }
 
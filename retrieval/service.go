@@ -12,50 +12,80 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 	"crypto/sha256"
 
 	"github.com/aymenfurter/bicep-copilot/openai"
+	"github.com/aymenfurter/bicep-copilot/usage"
 )
 
+const DefaultTopK = 3
+
 type Service struct {
 	cache         *Cache
 	repoConfig    *RepoConfig
 	httpClient    *http.Client
 	openAI        *openai.Client
-	initOnce      sync.Once
-	initErr       error
 	embeddingsMap sync.Map
+	version       atomic.Value
+	usage         *usage.Recorder
+	topK          atomic.Int32
+
+	statusMu sync.Mutex
+	status   IndexStatus
 }
 
-func NewService(repoConfig *RepoConfig) (*Service, error) {
+func NewService(repoConfig *RepoConfig, recorder *usage.Recorder) (*Service, error) {
 	openAIClient, err := openai.NewClient()
 	if (err != nil) {
 		return nil, fmt.Errorf("failed to create OpenAI client: %w", err)
 	}
 
-	return &Service{
+	s := &Service{
 		cache:      NewCache(),
 		repoConfig: repoConfig,
 		openAI:     openAIClient,
+		usage:      recorder,
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
-	}, nil
+	}
+	s.SetTopK(DefaultTopK)
+	return s, nil
+}
+
+func (s *Service) SetTopK(n int) {
+	if n <= 0 {
+		n = DefaultTopK
+	}
+	s.topK.Store(int32(n))
 }
 
 func (s *Service) Initialize(ctx context.Context) error {
-	s.initOnce.Do(func() {
-		s.initErr = s.initialize(ctx)
-		if s.initErr != nil {
-			log.Printf("Failed to initialize service: %v", s.initErr)
-		} else {
-			log.Printf("Successfully initialized service with embeddings")
-		}
+	if s.cache.IsLoaded() {
+		return nil
+	}
+
+	s.updateStatus(func(status *IndexStatus) {
+		status.Attempts++
+		status.Error = ""
 	})
-	return s.initErr
+
+	if err := s.initialize(ctx); err != nil {
+		log.Printf("Failed to initialize service: %v", err)
+		s.updateStatus(func(status *IndexStatus) {
+			status.Phase = IndexFailed
+			status.Error = err.Error()
+		})
+		return err
+	}
+
+	log.Printf("Successfully initialized service with embeddings")
+	return nil
 }
 
 func (s *Service) initialize(ctx context.Context) error {
@@ -63,10 +93,11 @@ func (s *Service) initialize(ctx context.Context) error {
 		log.Printf("Failed to load cache from disk: %v", err)
 	} else if len(s.cache.List()) > 0 {
 		log.Printf("Loaded %d documents from cache", len(s.cache.List()))
-		s.cache.SetLoaded()
+		s.markLoaded()
 		return nil
 	}
 
+	s.setPhase(IndexDownloading)
 	zipData, err := s.downloadRepo()
 	if err != nil {
 		return fmt.Errorf("failed to download repository: %w", err)
@@ -90,6 +121,11 @@ func (s *Service) initialize(ctx context.Context) error {
 		return fmt.Errorf("failed to process directory: %w", err)
 	}
 
+	s.updateStatus(func(status *IndexStatus) {
+		status.Phase = IndexEmbedding
+		status.Documents = len(docs)
+		status.Embedded = 0
+	})
 	if err := s.generateEmbeddings(ctx, docs); err != nil {
 		return fmt.Errorf("failed to generate embeddings: %w", err)
 	}
@@ -97,7 +133,7 @@ func (s *Service) initialize(ctx context.Context) error {
 	for _, doc := range docs {
 		s.cache.Store(doc)
 	}
-	s.cache.SetLoaded()
+	s.markLoaded()
 
 	log.Printf("Successfully initialized %d documents with embeddings", len(docs))
 
@@ -130,10 +166,14 @@ func (s *Service) generateEmbeddings(ctx context.Context, docs []*Document) erro
 		if err != nil {
 			return fmt.Errorf("failed to generate embeddings for batch: %w", err)
 		}
+		s.recordEmbeddingUsage(usage.Attribution{User: usage.SystemUser}, resp)
 
 		for j, data := range resp.Data {
 			batch[j].Embedding = data.Embedding
 		}
+		s.updateStatus(func(status *IndexStatus) {
+			status.Embedded = end
+		})
 
 		if end < len(docs) {
 			time.Sleep(10 * time.Millisecond)
@@ -145,18 +185,28 @@ func (s *Service) generateEmbeddings(ctx context.Context, docs []*Document) erro
 
 func (s *Service) FindRelevantDocuments(ctx context.Context, query string) ([]*Document, error) {
 	if !s.cache.IsLoaded() {
-		return nil, fmt.Errorf("service not initialized")
+		return nil, ErrNotReady
 	}
 
+	queryEmbedding, err := s.EmbedQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.findSimilarDocuments(queryEmbedding)
+}
+
+func (s *Service) EmbedQuery(ctx context.Context, query string) ([]float32, error) {
 	queryHash := fmt.Sprintf("%x", sha256.Sum256([]byte(query)))
 	if cachedEmbedding, ok := s.embeddingsMap.Load(queryHash); ok {
-		return s.findSimilarDocuments(cachedEmbedding.([]float32))
+		return cachedEmbedding.([]float32), nil
 	}
 
 	resp, err := s.openAI.CreateEmbeddings(ctx, []string{query})
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate query embedding: %w", err)
 	}
+	s.recordEmbeddingUsage(usage.AttributionFrom(ctx), resp)
 
 	if len(resp.Data) == 0 {
 		return nil, fmt.Errorf("no embedding generated for query")
@@ -165,7 +215,49 @@ func (s *Service) FindRelevantDocuments(ctx context.Context, query string) ([]*D
 	queryEmbedding := resp.Data[0].Embedding
 	s.embeddingsMap.Store(queryHash, queryEmbedding)
 
-	return s.findSimilarDocuments(queryEmbedding)
+	return queryEmbedding, nil
+}
+
+func (s *Service) Version() string {
+	version, _ := s.version.Load().(string)
+	return version
+}
+
+func (s *Service) markLoaded() {
+	docs := s.cache.List()
+	s.version.Store(corpusVersion(docs))
+	s.cache.SetLoaded()
+	s.updateStatus(func(status *IndexStatus) {
+		status.Phase = IndexReady
+		status.Documents = len(docs)
+		status.Embedded = len(docs)
+	})
+}
+
+func corpusVersion(docs []*Document) string {
+	sort.Slice(docs, func(i, j int) bool {
+		return docs[i].Path < docs[j].Path
+	})
+
+	hash := sha256.New()
+	for _, doc := range docs {
+		hash.Write([]byte(doc.Path))
+		hash.Write([]byte{0})
+		hash.Write([]byte(doc.Content))
+		hash.Write([]byte{0})
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil))[:16]
+}
+
+func (s *Service) recordEmbeddingUsage(attribution usage.Attribution, resp *openai.EmbeddingsResponse) {
+	s.usage.Record(usage.Record{
+		User:          attribution.User,
+		IntegrationID: attribution.IntegrationID,
+		Kind:          usage.KindEmbedding,
+		Model:         resp.Model,
+		PromptTokens:  resp.Usage.PromptTokens,
+		TotalTokens:   resp.Usage.TotalTokens,
+	})
 }
 
 func (s *Service) findSimilarDocuments(queryEmbedding []float32) ([]*Document, error) {
@@ -176,7 +268,7 @@ func (s *Service) findSimilarDocuments(queryEmbedding []float32) ([]*Document, e
 	}, len(docs))
 
 	for i, doc := range docs {
-		score := cosineSimilarity(queryEmbedding, doc.Embedding)
+		score := CosineSimilarity(queryEmbedding, doc.Embedding)
 		scored[i] = struct {
 			doc   *Document
 			score float32
@@ -185,14 +277,16 @@ func (s *Service) findSimilarDocuments(queryEmbedding []float32) ([]*Document, e
 
 	quicksortBySimilarity(scored)
 
-	resultCount := 3
+	resultCount := int(s.topK.Load())
 	if len(scored) < resultCount {
 		resultCount = len(scored)
 	}
 
 	results := make([]*Document, resultCount)
 	for i := 0; i < resultCount; i++ {
-		results[i] = scored[i].doc
+		result := *scored[i].doc
+		result.Score = scored[i].score
+		results[i] = &result
 	}
 
 	return results, nil
@@ -297,7 +391,7 @@ func (s *Service) processDirectory(root string) ([]*Document, error) {
 	return docs, nil
 }
 
-func cosineSimilarity(a, b []float32) float32 {
+func CosineSimilarity(a, b []float32) float32 {
 	var dot, magA, magB float32
 	for i := 0; i < len(a); i++ {
 		dot += a[i] * b[i]
@@ -12,7 +12,7 @@ func TestNewService(t *testing.T) {
 		RootPath: "docs",
 	}
 
-	service, err := NewService(config)
+	service, err := NewService(config, nil)
 	if err != nil {
 		t.Fatalf("NewService() error = %v", err)
 	}
@@ -0,0 +1,103 @@
+package retrieval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+const maxRetryInterval = 10 * time.Minute
+
+var ErrNotReady = errors.New("document index is not ready")
+
+type IndexPhase string
+
+const (
+	IndexPending     IndexPhase = "pending"
+	IndexDownloading IndexPhase = "downloading"
+	IndexEmbedding   IndexPhase = "embedding"
+	IndexReady       IndexPhase = "ready"
+	IndexFailed      IndexPhase = "failed"
+)
+
+type IndexStatus struct {
+	Phase     IndexPhase `json:"phase"`
+	Documents int        `json:"documents"`
+	Embedded  int        `json:"embedded"`
+	Progress  float64    `json:"progress"`
+	Attempts  int        `json:"attempts"`
+	Error     string     `json:"error,omitempty"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+func (s IndexStatus) Ready() bool {
+	return s.Phase == IndexReady
+}
+
+func (s *Service) Status() IndexStatus {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+
+	status := s.status
+	if status.Phase == "" {
+		status.Phase = IndexPending
+	}
+	switch {
+	case status.Ready():
+		status.Progress = 1
+	case status.Documents > 0:
+		status.Progress = float64(status.Embedded) / float64(status.Documents)
+	}
+	return status
+}
+
+func (s *Service) updateStatus(update func(*IndexStatus)) {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+
+	update(&s.status)
+	s.status.UpdatedAt = time.Now()
+}
+
+func (s *Service) setPhase(phase IndexPhase) {
+	s.updateStatus(func(status *IndexStatus) {
+		status.Phase = phase
+	})
+}
+
+func (s *Service) Run(ctx context.Context, retryInterval time.Duration) {
+	wait := retryInterval
+	for {
+		if err := s.Initialize(ctx); err == nil {
+			return
+		}
+
+		log.Printf("Retrying document indexing in %v", wait)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		if wait *= 2; wait > maxRetryInterval {
+			wait = maxRetryInterval
+		}
+	}
+}
+
+func (s *Service) ReadinessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := s.Status()
+
+		w.Header().Set("Content-Type", "application/json")
+		if !status.Ready() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			log.Printf("Failed to write readiness status: %v", err)
+		}
+	}
+}
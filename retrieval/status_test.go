@@ -0,0 +1,51 @@
+package retrieval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadinessHandler(t *testing.T) {
+	s := &Service{cache: NewCache()}
+	handler := s.ReadinessHandler()
+
+	if _, err := s.FindRelevantDocuments(context.Background(), "storage account"); !errors.Is(err, ErrNotReady) {
+		t.Errorf("FindRelevantDocuments() before indexing error = %v, want ErrNotReady", err)
+	}
+
+	s.updateStatus(func(status *IndexStatus) {
+		status.Phase = IndexEmbedding
+		status.Documents = 4
+		status.Embedded = 1
+	})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("readyz while indexing status = %d, want 503", w.Code)
+	}
+	var status IndexStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if status.Phase != IndexEmbedding || status.Progress != 0.25 {
+		t.Errorf("readyz while indexing = %+v, want embedding at 0.25", status)
+	}
+
+	s.cache.Store(&Document{Path: "a.md"})
+	s.cache.Store(&Document{Path: "b.md"})
+	s.markLoaded()
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("readyz after indexing status = %d, want 200", w.Code)
+	}
+	if status := s.Status(); !status.Ready() || status.Documents != 2 || status.Progress != 1 {
+		t.Errorf("Status() after indexing = %+v", status)
+	}
+}
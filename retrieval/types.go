@@ -19,6 +19,7 @@ type Document struct {
 	Content   string     `json:"content"`
 	Embedding []float32  `json:"embedding"`
 	Modified  time.Time  `json:"modified"`
+	Score     float32    `json:"-"`
 }
 
 type Cache struct {
@@ -0,0 +1,88 @@
+package signature
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	defaultDevKeyDir  = ".bicep-copilot"
+	defaultDevKeyFile = "dev-signing-key.pem"
+)
+
+func DefaultDevKeyPath() string {
+	return filepath.Join(os.Getenv("HOME"), defaultDevKeyDir, defaultDevKeyFile)
+}
+
+func LoadOrCreateDevKey(path string) (*ecdsa.PrivateKey, error) {
+	key, err := LoadDevKey(path)
+	if err == nil {
+		return key, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal signing key: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create signing key directory: %w", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write signing key: %w", err)
+	}
+	return key, nil
+}
+
+func LoadDevKey(path string) (*ecdsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM block in %s", path)
+	}
+
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %w", err)
+	}
+	return key, nil
+}
+
+func KeyIdentifier(key *ecdsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	digest := sha256.Sum256(der)
+	return hex.EncodeToString(digest[:]), nil
+}
+
+func NewDevKeySet(key *ecdsa.PrivateKey) (*KeySet, error) {
+	id, err := KeyIdentifier(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return NewStaticKeySet(map[string]*ecdsa.PublicKey{id: &key.PublicKey}, id), nil
+}
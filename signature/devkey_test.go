@@ -0,0 +1,38 @@
+package signature_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/aymenfurter/bicep-copilot/copilottest"
+	"github.com/aymenfurter/bicep-copilot/signature"
+)
+
+func TestDevKeySet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dev-signing-key.pem")
+
+	key, err := signature.LoadOrCreateDevKey(path)
+	if err != nil {
+		t.Fatalf("LoadOrCreateDevKey() error = %v", err)
+	}
+	reloaded, err := signature.LoadOrCreateDevKey(path)
+	if err != nil {
+		t.Fatalf("LoadOrCreateDevKey() reload error = %v", err)
+	}
+	if !key.Equal(reloaded) {
+		t.Error("LoadOrCreateDevKey() generated a new key instead of reusing the stored one")
+	}
+
+	keySet, err := signature.NewDevKeySet(key)
+	if err != nil {
+		t.Fatalf("NewDevKeySet() error = %v", err)
+	}
+
+	signer, _ := copilottest.NewSignerFromKey(key)
+	payload := []byte(`{"messages":[]}`)
+	sig, _ := signer.Sign(payload)
+	if err := signature.Verify(context.Background(), keySet, payload, sig, signer.KeyID); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+}
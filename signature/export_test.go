@@ -0,0 +1,7 @@
+package signature
+
+import "time"
+
+func SetClock(k *KeySet, now func() time.Time) {
+	k.now = now
+}
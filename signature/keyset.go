@@ -0,0 +1,243 @@
+package signature
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultKeysURL = "https://api.github.com/meta/public_keys/copilot_api"
+
+	defaultRefreshInterval    = time.Hour
+	defaultMinRefreshInterval = time.Minute
+)
+
+var ErrUnknownKey = errors.New("unknown public key identifier")
+
+type KeyProvider interface {
+	Key(ctx context.Context, id string) (*ecdsa.PublicKey, error)
+}
+
+type KeySetOptions struct {
+	URL                string
+	RefreshInterval    time.Duration
+	MinRefreshInterval time.Duration
+	HTTPClient         *http.Client
+}
+
+type KeySet struct {
+	url                string
+	httpClient         *http.Client
+	refreshInterval    time.Duration
+	minRefreshInterval time.Duration
+
+	mu          sync.RWMutex
+	keys        map[string]*ecdsa.PublicKey
+	current     string
+	refreshMu   sync.Mutex
+	lastRefresh time.Time
+	now         func() time.Time
+}
+
+func NewKeySet(opts KeySetOptions) *KeySet {
+	if opts.URL == "" {
+		opts.URL = DefaultKeysURL
+	}
+	if opts.RefreshInterval <= 0 {
+		opts.RefreshInterval = defaultRefreshInterval
+	}
+	if opts.MinRefreshInterval <= 0 {
+		opts.MinRefreshInterval = defaultMinRefreshInterval
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &KeySet{
+		url:                opts.URL,
+		httpClient:         opts.HTTPClient,
+		refreshInterval:    opts.RefreshInterval,
+		minRefreshInterval: opts.MinRefreshInterval,
+		keys:               make(map[string]*ecdsa.PublicKey),
+		now:                time.Now,
+	}
+}
+
+func NewStaticKeySet(keys map[string]*ecdsa.PublicKey, current string) *KeySet {
+	k := NewKeySet(KeySetOptions{})
+	k.keys = keys
+	k.current = current
+	k.url = ""
+	return k
+}
+
+func (k *KeySet) Key(ctx context.Context, id string) (*ecdsa.PublicKey, error) {
+	if key, ok := k.lookup(id); ok {
+		return key, nil
+	}
+
+	refreshed, err := k.refreshIfAllowed(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if refreshed {
+		if key, ok := k.lookup(id); ok {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnknownKey, id)
+}
+
+func (k *KeySet) lookup(id string) (*ecdsa.PublicKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if id == "" {
+		id = k.current
+	}
+	key, ok := k.keys[id]
+	return key, ok
+}
+
+func (k *KeySet) refreshIfAllowed(ctx context.Context) (bool, error) {
+	if k.url == "" {
+		return false, nil
+	}
+
+	k.refreshMu.Lock()
+	defer k.refreshMu.Unlock()
+
+	if k.now().Sub(k.lastRefresh) < k.minRefreshInterval {
+		return false, nil
+	}
+	if err := k.refreshLocked(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (k *KeySet) Refresh(ctx context.Context) error {
+	if k.url == "" {
+		return nil
+	}
+
+	k.refreshMu.Lock()
+	defer k.refreshMu.Unlock()
+	return k.refreshLocked(ctx)
+}
+
+func (k *KeySet) refreshLocked(ctx context.Context) error {
+	k.lastRefresh = k.now()
+
+	keys, current, err := k.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.current = current
+	k.mu.Unlock()
+
+	log.Printf("Loaded %d Copilot public keys (current %s)", len(keys), current)
+	return nil
+}
+
+func (k *KeySet) Run(ctx context.Context) {
+	ticker := time.NewTicker(k.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := k.Refresh(ctx); err != nil {
+				log.Printf("Failed to refresh Copilot public keys: %v", err)
+			}
+		}
+	}
+}
+
+func (k *KeySet) fetch(ctx context.Context) (map[string]*ecdsa.PublicKey, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.url, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := k.httpClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to fetch public keys: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var respBody struct {
+		PublicKeys []struct {
+			KeyIdentifier string `json:"key_identifier"`
+			Key           string `json:"key"`
+			IsCurrent     bool   `json:"is_current"`
+		} `json:"public_keys"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+		return nil, "", fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	keys := make(map[string]*ecdsa.PublicKey, len(respBody.PublicKeys))
+	var current string
+	for _, pk := range respBody.PublicKeys {
+		key, err := ParsePublicKey(pk.Key)
+		if err != nil {
+			log.Printf("Skipping public key %s: %v", pk.KeyIdentifier, err)
+			continue
+		}
+		keys[pk.KeyIdentifier] = key
+		if pk.IsCurrent {
+			current = pk.KeyIdentifier
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, "", fmt.Errorf("no valid public keys found")
+	}
+	if current == "" {
+		return nil, "", fmt.Errorf("no current public key found")
+	}
+
+	return keys, current, nil
+}
+
+func ParsePublicKey(pemKey string) (*ecdsa.PublicKey, error) {
+	pemStr := strings.ReplaceAll(pemKey, "\\n", "\n")
+	block, _ := pem.Decode([]byte(pemStr))
+	if block == nil {
+		return nil, fmt.Errorf("failed to parse PEM block")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+
+	ecdsaKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("key is not ECDSA")
+	}
+
+	return ecdsaKey, nil
+}
@@ -0,0 +1,83 @@
+package signature_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aymenfurter/bicep-copilot/copilottest"
+	"github.com/aymenfurter/bicep-copilot/signature"
+)
+
+type rotatingKeys struct {
+	mu      sync.Mutex
+	handler http.HandlerFunc
+	calls   int
+}
+
+func (r *rotatingKeys) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	r.calls++
+	handler := r.handler
+	r.mu.Unlock()
+	handler(w, req)
+}
+
+func (r *rotatingKeys) set(handler http.HandlerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handler = handler
+}
+
+func TestKeySetRotation(t *testing.T) {
+	oldSigner, _ := copilottest.NewSigner()
+	newSigner, _ := copilottest.NewSigner()
+
+	keys := &rotatingKeys{handler: copilottest.KeysHandler(oldSigner)}
+	server := httptest.NewServer(keys)
+	defer server.Close()
+
+	now := time.Now()
+	keySet := signature.NewKeySet(signature.KeySetOptions{URL: server.URL, MinRefreshInterval: time.Minute})
+	signature.SetClock(keySet, func() time.Time { return now })
+
+	ctx := context.Background()
+	if err := keySet.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+
+	if key, err := keySet.Key(ctx, ""); err != nil || !key.Equal(oldSigner.PublicKey()) {
+		t.Errorf("Key(\"\") = %v, %v, want current key", key, err)
+	}
+
+	keys.set(copilottest.KeysHandler(newSigner, oldSigner))
+
+	if _, err := keySet.Key(ctx, newSigner.KeyID); !errors.Is(err, signature.ErrUnknownKey) {
+		t.Errorf("Key() within min refresh interval error = %v, want ErrUnknownKey", err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	key, err := keySet.Key(ctx, newSigner.KeyID)
+	if err != nil || !key.Equal(newSigner.PublicKey()) {
+		t.Fatalf("Key() after rotation = %v, %v, want new key", key, err)
+	}
+
+	if key, err := keySet.Key(ctx, oldSigner.KeyID); err != nil || !key.Equal(oldSigner.PublicKey()) {
+		t.Errorf("Key() for previous key = %v, %v, want previous key still accepted", key, err)
+	}
+
+	if _, err := keySet.Key(ctx, "unknown"); !errors.Is(err, signature.ErrUnknownKey) {
+		t.Errorf("Key(unknown) error = %v, want ErrUnknownKey", err)
+	}
+
+	keys.mu.Lock()
+	calls := keys.calls
+	keys.mu.Unlock()
+	if calls != 2 {
+		t.Errorf("key endpoint called %d times, want 2", calls)
+	}
+}
@@ -0,0 +1,132 @@
+package signature
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+)
+
+const (
+	SignatureHeader     = "Github-Public-Key-Signature"
+	KeyIdentifierHeader = "Github-Public-Key-Identifier"
+
+	DefaultMaxBodyBytes int64 = 4 << 20
+)
+
+var (
+	ErrMissingSignature   = errors.New("missing payload signature")
+	ErrMalformedSignature = errors.New("malformed payload signature")
+	ErrInvalidSignature   = errors.New("invalid payload signature")
+)
+
+type MiddlewareOptions struct {
+	MaxBodyBytes int64
+}
+
+type errorResponse struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type asn1Signature struct {
+	R *big.Int
+	S *big.Int
+}
+
+func Middleware(keys KeyProvider, opts MiddlewareOptions) func(http.Handler) http.Handler {
+	if opts.MaxBodyBytes <= 0 {
+		opts.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, opts.MaxBodyBytes))
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					writeError(w, http.StatusRequestEntityTooLarge, "payload_too_large",
+						fmt.Sprintf("request body exceeds %d bytes", opts.MaxBodyBytes))
+					return
+				}
+				writeError(w, http.StatusBadRequest, "invalid_body", "failed to read request body")
+				return
+			}
+
+			sig := r.Header.Get(SignatureHeader)
+			keyID := r.Header.Get(KeyIdentifierHeader)
+			if err := Verify(r.Context(), keys, body, sig, keyID); err != nil {
+				log.Printf("Rejected request to %s: %v", r.URL.Path, err)
+				switch {
+				case errors.Is(err, ErrMissingSignature):
+					writeError(w, http.StatusUnauthorized, "missing_signature", err.Error())
+				case errors.Is(err, ErrMalformedSignature):
+					writeError(w, http.StatusUnauthorized, "malformed_signature", ErrMalformedSignature.Error())
+				case errors.Is(err, ErrUnknownKey):
+					writeError(w, http.StatusUnauthorized, "unknown_key", ErrUnknownKey.Error())
+				case errors.Is(err, ErrInvalidSignature):
+					writeError(w, http.StatusUnauthorized, "invalid_signature", err.Error())
+				default:
+					writeError(w, http.StatusServiceUnavailable, "key_unavailable", "unable to load public keys")
+				}
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			r.ContentLength = int64(len(body))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func Verify(ctx context.Context, keys KeyProvider, payload []byte, sig, keyID string) error {
+	if sig == "" {
+		return ErrMissingSignature
+	}
+
+	asnSig, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedSignature, err)
+	}
+
+	parsedSig := asn1Signature{}
+	rest, err := asn1.Unmarshal(asnSig, &parsedSig)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedSignature, err)
+	}
+	if len(rest) != 0 || parsedSig.R == nil || parsedSig.S == nil {
+		return fmt.Errorf("%w: trailing data", ErrMalformedSignature)
+	}
+
+	pubKey, err := keys.Key(ctx, keyID)
+	if err != nil {
+		return err
+	}
+
+	digest := sha256.Sum256(payload)
+	if !ecdsa.Verify(pubKey, digest[:], parsedSig.R, parsedSig.S) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	var resp errorResponse
+	resp.Error.Code = code
+	resp.Error.Message = message
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
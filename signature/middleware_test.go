@@ -0,0 +1,94 @@
+package signature_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aymenfurter/bicep-copilot/copilottest"
+	"github.com/aymenfurter/bicep-copilot/signature"
+)
+
+func TestMiddleware(t *testing.T) {
+	signer, err := copilottest.NewSigner()
+	if err != nil {
+		t.Fatalf("NewSigner() error = %v", err)
+	}
+	keys := signature.NewStaticKeySet(map[string]*ecdsa.PublicKey{signer.KeyID: signer.PublicKey()}, signer.KeyID)
+
+	var received []byte
+	handler := signature.Middleware(keys, signature.MiddlewareOptions{MaxBodyBytes: 64})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	payload := []byte(`{"messages":[]}`)
+	validSig, _ := signer.Sign(payload)
+	otherSigner, _ := copilottest.NewSigner()
+	otherSig, _ := otherSigner.Sign(payload)
+
+	tests := []struct {
+		name   string
+		body   []byte
+		sig    string
+		keyID  string
+		status int
+		code   string
+	}{
+		{"valid", payload, validSig, signer.KeyID, http.StatusNoContent, ""},
+		{"valid without key id", payload, validSig, "", http.StatusNoContent, ""},
+		{"missing signature", payload, "", "", http.StatusUnauthorized, "missing_signature"},
+		{"malformed base64", payload, "not-base64!", "", http.StatusUnauthorized, "malformed_signature"},
+		{"malformed asn1", payload, "aGVsbG8=", "", http.StatusUnauthorized, "malformed_signature"},
+		{"wrong key", payload, otherSig, signer.KeyID, http.StatusUnauthorized, "invalid_signature"},
+		{"unknown key id", payload, validSig, "rotated-away", http.StatusUnauthorized, "unknown_key"},
+		{"too large", []byte(strings.Repeat("x", 65)), validSig, "", http.StatusRequestEntityTooLarge, "payload_too_large"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = nil
+			r := httptest.NewRequest(http.MethodPost, "/agent", bytes.NewReader(tt.body))
+			if tt.sig != "" {
+				r.Header.Set(signature.SignatureHeader, tt.sig)
+			}
+			if tt.keyID != "" {
+				r.Header.Set(signature.KeyIdentifierHeader, tt.keyID)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+
+			if tt.code == "" {
+				if !bytes.Equal(received, tt.body) {
+					t.Errorf("handler received body %q, want %q", received, tt.body)
+				}
+				return
+			}
+
+			var resp struct {
+				Error struct {
+					Code string `json:"code"`
+				} `json:"error"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode error response: %v", err)
+			}
+			if resp.Error.Code != tt.code {
+				t.Errorf("error code = %q, want %q", resp.Error.Code, tt.code)
+			}
+			if received != nil {
+				t.Error("handler was called for a rejected request")
+			}
+		})
+	}
+}
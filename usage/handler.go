@@ -0,0 +1,51 @@
+package usage
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+type totalsResponse struct {
+	Users []UserTotals `json:"users"`
+	Total struct {
+		Completion Totals `json:"completion"`
+		Embedding  Totals `json:"embedding"`
+	} `json:"total"`
+}
+
+func (r *Recorder) Handler(adminToken string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var resp totalsResponse
+		resp.Users = r.Totals()
+		for _, entry := range resp.Users {
+			resp.Total.Completion = sum(resp.Total.Completion, entry.Completion)
+			resp.Total.Embedding = sum(resp.Total.Embedding, entry.Embedding)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func sum(a, b Totals) Totals {
+	return Totals{
+		Requests:         a.Requests + b.Requests,
+		PromptTokens:     a.PromptTokens + b.PromptTokens,
+		CompletionTokens: a.CompletionTokens + b.CompletionTokens,
+		TotalTokens:      a.TotalTokens + b.TotalTokens,
+	}
+}
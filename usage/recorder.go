@@ -0,0 +1,209 @@
+package usage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	KindCompletion = "completion"
+	KindEmbedding  = "embedding"
+
+	SystemUser = "system"
+)
+
+type Record struct {
+	Time             time.Time `json:"time"`
+	User             string    `json:"user"`
+	IntegrationID    string    `json:"integration_id,omitempty"`
+	Kind             string    `json:"kind"`
+	Model            string    `json:"model,omitempty"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	TotalTokens      int       `json:"total_tokens"`
+}
+
+type Totals struct {
+	Requests         int `json:"requests"`
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type UserTotals struct {
+	User          string `json:"user"`
+	IntegrationID string `json:"integration_id,omitempty"`
+	Completion    Totals `json:"completion"`
+	Embedding     Totals `json:"embedding"`
+}
+
+type totalsKey struct {
+	user          string
+	integrationID string
+}
+
+type Recorder struct {
+	mu     sync.Mutex
+	file   *os.File
+	totals map[totalsKey]*UserTotals
+}
+
+func NewRecorder(logPath string) (*Recorder, error) {
+	r := &Recorder{
+		totals: make(map[totalsKey]*UserTotals),
+	}
+
+	if logPath == "" {
+		return r, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create usage log directory: %w", err)
+	}
+
+	if err := r.replay(logPath); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open usage log: %w", err)
+	}
+	r.file = file
+
+	return r, nil
+}
+
+func (r *Recorder) replay(logPath string) error {
+	file, err := os.Open(logPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to open usage log: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			log.Printf("Skipping invalid usage log line %d: %v", lineNum, err)
+			continue
+		}
+		r.add(rec)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read usage log: %w", err)
+	}
+	return nil
+}
+
+func (r *Recorder) Record(rec Record) {
+	if r == nil {
+		return
+	}
+	if rec.Time.IsZero() {
+		rec.Time = time.Now().UTC()
+	}
+	if rec.User == "" {
+		rec.User = SystemUser
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.add(rec)
+
+	if r.file == nil {
+		return
+	}
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		log.Printf("Failed to encode usage record: %v", err)
+		return
+	}
+	if _, err := r.file.Write(append(line, '\n')); err != nil {
+		log.Printf("Failed to write usage record: %v", err)
+	}
+}
+
+func (r *Recorder) add(rec Record) {
+	key := totalsKey{user: rec.User, integrationID: rec.IntegrationID}
+	entry, ok := r.totals[key]
+	if !ok {
+		entry = &UserTotals{User: rec.User, IntegrationID: rec.IntegrationID}
+		r.totals[key] = entry
+	}
+
+	target := &entry.Completion
+	if rec.Kind == KindEmbedding {
+		target = &entry.Embedding
+	}
+	target.Requests++
+	target.PromptTokens += rec.PromptTokens
+	target.CompletionTokens += rec.CompletionTokens
+	target.TotalTokens += rec.TotalTokens
+}
+
+func (r *Recorder) Totals() []UserTotals {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	totals := make([]UserTotals, 0, len(r.totals))
+	for _, entry := range r.totals {
+		totals = append(totals, *entry)
+	}
+
+	sort.Slice(totals, func(i, j int) bool {
+		if totals[i].User != totals[j].User {
+			return totals[i].User < totals[j].User
+		}
+		return totals[i].IntegrationID < totals[j].IntegrationID
+	})
+	return totals
+}
+
+func (r *Recorder) Close() error {
+	if r == nil || r.file == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
+
+type attributionKey struct{}
+
+type Attribution struct {
+	User          string
+	IntegrationID string
+}
+
+func WithAttribution(ctx context.Context, user, integrationID string) context.Context {
+	return context.WithValue(ctx, attributionKey{}, Attribution{User: user, IntegrationID: integrationID})
+}
+
+func AttributionFrom(ctx context.Context) Attribution {
+	if attribution, ok := ctx.Value(attributionKey{}).(Attribution); ok {
+		return attribution
+	}
+	return Attribution{User: SystemUser}
+}
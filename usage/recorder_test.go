@@ -0,0 +1,84 @@
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecorderTotalsAndReplay(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "usage.ndjson")
+
+	recorder, err := NewRecorder(logPath)
+	if err != nil {
+		t.Fatalf("NewRecorder() error = %v", err)
+	}
+
+	recorder.Record(Record{User: "octocat", IntegrationID: "vscode", Kind: KindCompletion, PromptTokens: 100, CompletionTokens: 20, TotalTokens: 120})
+	recorder.Record(Record{User: "octocat", IntegrationID: "vscode", Kind: KindEmbedding, PromptTokens: 8, TotalTokens: 8})
+	recorder.Record(Record{Kind: KindEmbedding, PromptTokens: 500, TotalTokens: 500})
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	replayed, err := NewRecorder(logPath)
+	if err != nil {
+		t.Fatalf("NewRecorder() replay error = %v", err)
+	}
+	defer replayed.Close()
+
+	totals := replayed.Totals()
+	if len(totals) != 2 {
+		t.Fatalf("Totals() got %d entries, want 2", len(totals))
+	}
+
+	if totals[0].User != "octocat" || totals[0].Completion.TotalTokens != 120 || totals[0].Embedding.TotalTokens != 8 {
+		t.Errorf("Totals() octocat = %+v", totals[0])
+	}
+
+	if totals[1].User != SystemUser || totals[1].Embedding.Requests != 1 {
+		t.Errorf("Totals() system = %+v", totals[1])
+	}
+}
+
+func TestHandlerRequiresAdminToken(t *testing.T) {
+	recorder, _ := NewRecorder("")
+	recorder.Record(Record{User: "octocat", Kind: KindCompletion, TotalTokens: 42})
+	handler := recorder.Handler("secret")
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/admin/usage", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Handler() without token status = %d, want 401", w.Code)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/admin/usage", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	handler(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Handler() status = %d, want 200", w.Code)
+	}
+
+	var resp totalsResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Total.Completion.TotalTokens != 42 {
+		t.Errorf("Handler() total completion tokens = %d, want 42", resp.Total.Completion.TotalTokens)
+	}
+}
+
+func TestAttribution(t *testing.T) {
+	if got := AttributionFrom(context.Background()); got.User != SystemUser {
+		t.Errorf("AttributionFrom() = %+v, want system user", got)
+	}
+
+	ctx := WithAttribution(context.Background(), "octocat", "vscode")
+	if got := AttributionFrom(ctx); got.User != "octocat" || got.IntegrationID != "vscode" {
+		t.Errorf("AttributionFrom() = %+v", got)
+	}
+}